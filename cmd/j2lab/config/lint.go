@@ -12,8 +12,11 @@
 package config
 
 import (
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
 	"gitlab.com/infograb-public/j2lab/internal/utils"
 )
 
@@ -32,6 +35,25 @@ func newCmdConfigLint(ioStreams *utils.IOStreams) *cobra.Command {
 }
 
 func runConfigLint(ioStreams *utils.IOStreams) error {
-	_, err := config.GetConfig()
-	return err
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return err
+	}
+
+	//* Warn the Jira statuses of the project without mapping
+	if len(cfg.StatusMap) > 0 {
+		jr := config.GetJiraClient(cfg)
+		statuses, err := jirax.GetProjectStatuses(jr, cfg.Jira.Name)
+		if err != nil {
+			return errors.Wrap(err, "Error getting Jira statuses")
+		}
+
+		for _, status := range statuses {
+			if _, ok := cfg.GetStatusMapping(status.Name); !ok {
+				log.Warnf("Jira status %q of project %s is not mapped in status_map", status.Name, cfg.Jira.Name)
+			}
+		}
+	}
+
+	return nil
 }
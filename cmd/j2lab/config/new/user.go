@@ -56,12 +56,12 @@ func runConfigNewUser(io *utils.IOStreams) error {
 
 	jr := config.GetJiraClient(cfg)
 
-	jiraEpics, jiraIssues, err := j2g.GetJiraIssues(jr, cfg.Jira.Name, cfg.Jira.Jql)
+	jiraEpics, jiraIssues, err := j2g.GetJiraIssues(jr, cfg, cfg.Jira.Jql)
 	if err != nil {
 		return errors.Wrap(err, "Error getting Jira issues")
 	}
 
-	usernames, err := j2g.GetJiraUsernamesFromIssues(append(jiraEpics, jiraIssues...))
+	usernames, err := j2g.GetJiraUsernamesFromIssues(cfg, append(jiraEpics, jiraIssues...))
 	if err != nil {
 		return errors.Wrap(err, "Error getting Jira users")
 	}
@@ -95,13 +95,16 @@ func runConfigNewUser(io *utils.IOStreams) error {
 
 	for _, username := range usernames {
 		options := &jirax.UserQueryOptions{Username: username}
+		if cfg.IsJiraCloud() {
+			options = &jirax.UserQueryOptions{AccountId: username}
+		}
 
 		user, _, err := jirax.GetUser(jr, options)
 		if err != nil {
 			return errors.Wrap(err, fmt.Sprintf("Error getting user %s", username))
 		}
 
-		if _, err = file.WriteString(user.Name + ",\n"); err != nil {
+		if _, err = file.WriteString(cfg.JiraUserKey(user) + ",\n"); err != nil {
 			return errors.Wrap(err, "Error writing to file")
 		}
 	}
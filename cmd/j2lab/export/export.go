@@ -0,0 +1,121 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package export
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/j2g"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+type Options struct {
+	*utils.IOStreams
+
+	Output string
+}
+
+func NewOptions(ioStreams *utils.IOStreams) *Options {
+	return &Options{
+		IOStreams: ioStreams,
+	}
+}
+
+func NewCmdExport(ioStreams *utils.IOStreams) *cobra.Command {
+	o := NewOptions(ioStreams)
+	cmd := &cobra.Command{
+		Use:   "export [options]",
+		Short: "Export the Jira project to an archive",
+		Long:  "Read the Jira project, its versions, sprints, statuses, users, issues with their changelog and worklogs, and download the attachments into a directory or a .tar.gz file. Only Jira is called",
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckErr(o.complete(cmd, args))
+			utils.CheckErr(o.validate())
+			utils.CheckErr(o.run())
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.Output, "output", "o", "", "Archive directory, or tarball if it ends with .tar.gz or .tgz (default: <Jira project>-export)")
+	return cmd
+}
+
+func (o *Options) complete(cmd *cobra.Command, args []string) error {
+	if o.Output != "" {
+		return nil
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+	o.Output = fmt.Sprintf("%s-export", cfg.Jira.Name)
+	return nil
+}
+
+func (o *Options) isTarball() bool {
+	return strings.HasSuffix(o.Output, ".tar.gz") || strings.HasSuffix(o.Output, ".tgz")
+}
+
+func (o *Options) validate() error {
+	if o.isTarball() {
+		if utils.FileExists(o.Output) {
+			return errors.Errorf("Archive already exists: %s", o.Output)
+		}
+		return nil
+	}
+
+	entries, err := os.ReadDir(o.Output)
+	if err == nil && len(entries) > 0 {
+		return errors.Errorf("Archive directory is not empty: %s", o.Output)
+	}
+	return nil
+}
+
+func (o *Options) run() error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	jr := config.GetJiraClient(cfg)
+
+	//* The tarball is written from a temporary directory
+	dir := o.Output
+	if o.isTarball() {
+		dir, err = os.MkdirTemp("", "j2lab-export-")
+		if err != nil {
+			return errors.Wrap(err, "Error creating temporary directory")
+		}
+		defer os.RemoveAll(dir)
+	} else if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error creating archive directory: %s", dir))
+	}
+
+	archive, err := j2g.Export(jr, dir)
+	if err != nil {
+		return errors.Wrap(err, "Error exporting")
+	}
+
+	if o.isTarball() {
+		if err := utils.TarGzDirectory(dir, o.Output); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error writing archive: %s", o.Output))
+		}
+	}
+
+	fmt.Fprintf(o.Out, "Exported %d epics, %d issues and %d attachments of %s to %s\n",
+		len(archive.Epics), len(archive.Issues), len(archive.Attachments), cfg.Jira.Name, o.Output)
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package importer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/j2g"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/state"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+type Options struct {
+	*utils.IOStreams
+
+	From        string
+	Attachments string
+	Resume      bool
+}
+
+func NewOptions(ioStreams *utils.IOStreams) *Options {
+	return &Options{
+		IOStreams: ioStreams,
+	}
+}
+
+func NewCmdImport(ioStreams *utils.IOStreams) *cobra.Command {
+	o := NewOptions(ioStreams)
+	cmd := &cobra.Command{
+		Use:   "import --from <archive> [options]",
+		Short: "Run the migration from an exported archive",
+		Long:  "Run the same migration as the run command, reading the Jira project from an archive written by the export command, the entities.xml of a Jira backup or a Jira CSV export instead of Jira. Only GitLab is called",
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckErr(o.complete(cmd, args))
+			utils.CheckErr(o.validate())
+			utils.CheckErr(o.run())
+		},
+	}
+
+	cmd.Flags().StringVar(&o.From, "from", "", "Archive directory or tarball written by the export command, entities.xml of a Jira backup or Jira CSV export")
+	cmd.Flags().StringVar(&o.Attachments, "attachments", "", "Attachments directory of the Jira backup or CSV export (default: attachments next to the file)")
+	cmd.Flags().BoolVar(&o.Resume, "resume", false, "Skip the epics, issues and attachments recorded in the state file by a previous run")
+	return cmd
+}
+
+func (o *Options) complete(cmd *cobra.Command, args []string) error {
+	if o.Attachments == "" && (o.isXMLBackup() || o.isCSVExport()) {
+		o.Attachments = filepath.Join(filepath.Dir(o.From), "attachments")
+		if !utils.FileExists(o.Attachments) {
+			o.Attachments = ""
+		}
+	}
+	return nil
+}
+
+func (o *Options) isXMLBackup() bool {
+	return strings.EqualFold(filepath.Ext(o.From), ".xml")
+}
+
+func (o *Options) isCSVExport() bool {
+	return strings.EqualFold(filepath.Ext(o.From), ".csv")
+}
+
+// open opens the source of the Jira project from the file type
+func (o *Options) open(projectKey string) (*jirax.ArchiveSource, error) {
+	switch {
+	case o.isXMLBackup():
+		return jirax.OpenXMLBackup(o.From, o.Attachments, projectKey)
+	case o.isCSVExport():
+		return jirax.OpenCSVExport(o.From, o.Attachments, projectKey)
+	default:
+		return jirax.OpenArchive(o.From)
+	}
+}
+
+func (o *Options) validate() error {
+	if o.From == "" {
+		return errors.New("--from is required")
+	}
+	if !utils.FileExists(o.From) {
+		return errors.Errorf("Archive not found: %s", o.From)
+	}
+	return nil
+}
+
+func (o *Options) run() error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	src, err := o.open(cfg.Jira.Name)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error opening %s", o.From))
+	}
+	defer src.Close()
+	if o.Attachments == "" && len(src.Attachments) == 0 && (o.isXMLBackup() || o.isCSVExport()) {
+		log.Warnf("No attachments directory, the attachments are skipped")
+	}
+
+	//* Wiki markup and ADF are converted differently, the backups and CSV exports are in wiki markup
+	flavor := func(flavor string) string {
+		if flavor == "" {
+			return "server"
+		}
+		return flavor
+	}
+	if flavor(src.Flavor) != flavor(cfg.Jira.Flavor) {
+		return errors.Errorf("%s has the issues of Jira %s, but jira.flavor is %s", o.From, flavor(src.Flavor), flavor(cfg.Jira.Flavor))
+	}
+	if src.Host != "" && strings.TrimSuffix(src.Host, "/") != strings.TrimSuffix(cfg.Jira.Host, "/") {
+		log.Warnf("The archive was exported from %s, the links to Jira use %s", src.Host, cfg.Jira.Host)
+	}
+	lint(cfg, src.Archive)
+
+	log.Infof("Importing %d epics and %d issues of %s", len(src.Epics), len(src.Issues), src.Project.Key)
+
+	statePath, err := config.GetStatePath()
+	if err != nil {
+		return errors.Wrap(err, "Error getting state file path")
+	}
+
+	store, err := state.Open(statePath, o.Resume)
+	if err != nil {
+		return errors.Wrap(err, "Error opening state file")
+	}
+	defer store.Close()
+
+	gl := config.GetGitLabClient(cfg)
+	err = j2g.ConvertByProject(gl, src, store)
+
+	//* The skipped attachments are reported even if the run failed
+	if skipped := j2g.SkippedAttachments(); len(skipped) > 0 {
+		j2g.WriteSkippedAttachments(o.Out, skipped)
+	}
+	return err
+}
+
+// lint warns the statuses and users of the archive without mapping, as config lint does with Jira
+func lint(cfg *config.Config, archive *jirax.Archive) {
+	if len(cfg.StatusMap) > 0 {
+		for _, status := range archive.Statuses {
+			if _, ok := cfg.GetStatusMapping(status.Name); !ok {
+				log.Warnf("Jira status %q of project %s is not mapped in status_map", status.Name, cfg.Jira.Name)
+			}
+		}
+	}
+
+	for _, user := range archive.Users {
+		if key := cfg.JiraUserKey(user); key != "" {
+			if _, ok := cfg.Users[key]; !ok {
+				log.Warnf("Jira user %s (%s) is not mapped in the user file", user.DisplayName, key)
+			}
+		}
+	}
+}
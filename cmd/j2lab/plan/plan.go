@@ -0,0 +1,99 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/j2g"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+type Options struct {
+	*utils.IOStreams
+
+	Output string
+}
+
+func NewOptions(ioStreams *utils.IOStreams) *Options {
+	return &Options{
+		IOStreams: ioStreams,
+		Output:    "text",
+	}
+}
+
+func NewCmdPlan(ioStreams *utils.IOStreams) *cobra.Command {
+	o := NewOptions(ioStreams)
+	cmd := &cobra.Command{
+		Use:   "plan [options]",
+		Short: "Print what the run command would create",
+		Long:  "Read everything from Jira and GitLab without writing, and print the epics, issues, milestones and labels the run command would create. Exit with 1 if the run would fail or lose data",
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckErr(o.complete(cmd, args))
+			utils.CheckErr(o.validate())
+			//* Exit with 1 on problems, without mixing an error in the JSON output
+			ok, err := o.run()
+			utils.CheckErr(err)
+			if err != nil || !ok {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "One of 'text' or 'json'.")
+	return cmd
+}
+
+func (o *Options) complete(cmd *cobra.Command, args []string) error {
+	return nil
+}
+
+func (o *Options) validate() error {
+	if o.Output != "text" && o.Output != "json" {
+		return errors.Errorf("Invalid output format: %s", o.Output)
+	}
+	return nil
+}
+
+// run returns whether the plan has no problems
+func (o *Options) run() (bool, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return false, errors.Wrap(err, "Error getting config")
+	}
+
+	gl := config.GetGitLabClient(cfg)
+	jr := config.GetJiraClient(cfg)
+
+	plan, err := j2g.NewPlan(gl, jr)
+	if err != nil {
+		return false, errors.Wrap(err, "Error planning")
+	}
+
+	switch o.Output {
+	case "json":
+		result, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return false, errors.Wrap(err, "Error marshalling plan")
+		}
+		fmt.Fprintf(o.Out, "%s\n", result)
+	default:
+		plan.WriteText(o.Out)
+	}
+
+	return !plan.HasProblems(), nil
+}
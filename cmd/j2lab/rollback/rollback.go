@@ -0,0 +1,106 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package rollback
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/j2g"
+	"gitlab.com/infograb-public/j2lab/internal/state"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+type Options struct {
+	*utils.IOStreams
+
+	Yes bool
+}
+
+func NewOptions(ioStreams *utils.IOStreams) *Options {
+	return &Options{
+		IOStreams: ioStreams,
+	}
+}
+
+func NewCmdRollback(ioStreams *utils.IOStreams) *cobra.Command {
+	o := NewOptions(ioStreams)
+	cmd := &cobra.Command{
+		Use:   "rollback [options]",
+		Short: "Delete everything the migration created",
+		Long:  "Delete the epics, issues, milestones, iterations, labels and uploads recorded in the state file or imported from Jira. Pre-existing GitLab objects are never deleted",
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckErr(o.complete(cmd, args))
+			utils.CheckErr(o.validate())
+			utils.CheckErr(o.run())
+		},
+	}
+
+	cmd.Flags().BoolVarP(&o.Yes, "yes", "y", false, "Delete without confirmation")
+	return cmd
+}
+
+func (o *Options) complete(cmd *cobra.Command, args []string) error {
+	return nil
+}
+
+func (o *Options) validate() error {
+	return nil
+}
+
+func (o *Options) run() error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	statePath, err := config.GetStatePath()
+	if err != nil {
+		return errors.Wrap(err, "Error getting state file path")
+	}
+
+	store, err := state.Open(statePath, false)
+	if err != nil {
+		return errors.Wrap(err, "Error opening state file")
+	}
+	defer store.Close()
+
+	gl := config.GetGitLabClient(cfg)
+
+	rollback, err := j2g.NewRollback(gl, store)
+	if err != nil {
+		return errors.Wrap(err, "Error finding the objects to delete")
+	}
+
+	fmt.Fprintf(o.Out, "Rollback: GitLab project %s, group %s\n", cfg.GitLab.Issue, cfg.GitLab.Epic)
+	rollback.WriteText(o.Out)
+
+	if rollback.Count() == 0 {
+		fmt.Fprintf(o.Out, "\nNothing to delete\n")
+		return nil
+	}
+
+	if !o.Yes {
+		fmt.Fprintf(o.Out, "\nDelete %d objects? This cannot be undone [y/N]: ", rollback.Count())
+		answer, _ := bufio.NewReader(o.In).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			fmt.Fprintf(o.Out, "Rollback cancelled\n")
+			return nil
+		}
+	}
+
+	return rollback.Execute(gl, store)
+}
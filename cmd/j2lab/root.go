@@ -16,7 +16,13 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	configCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/config"
+	exportCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/export"
+	importCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/importer"
+	planCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/plan"
+	rollbackCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/rollback"
 	runCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/run"
+	syncCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/sync"
+	verifyCmd "gitlab.com/infograb-public/j2lab/cmd/j2lab/verify"
 	"gitlab.com/infograb-public/j2lab/cmd/j2lab/version"
 	"gitlab.com/infograb-public/j2lab/internal/utils"
 )
@@ -38,9 +44,15 @@ func init() {
 
 	rootCmd.PersistentFlags().StringP("config", "c", "", "config.yaml file")
 	rootCmd.PersistentFlags().StringP("user", "u", "", "user.csv file")
+	rootCmd.PersistentFlags().StringP("state", "s", "", "migration state file (default: j2lab.state.jsonl next to config.yaml)")
+	rootCmd.PersistentFlags().String("registry", "", "registry of the migrated Jira projects shared by their runs (default: j2lab.registry.jsonl next to config.yaml)")
+	rootCmd.PersistentFlags().String("cache", "", "attachment cache directory (default: j2lab.cache next to config.yaml)")
 	rootCmd.PersistentFlags().BoolP("debug", "d", false, "debug mode")
 	viper.BindPFlag("CONFIG_FILE", rootCmd.PersistentFlags().Lookup("config"))
 	viper.BindPFlag("USER_FILE", rootCmd.PersistentFlags().Lookup("user"))
+	viper.BindPFlag("STATE_FILE", rootCmd.PersistentFlags().Lookup("state"))
+	viper.BindPFlag("REGISTRY_FILE", rootCmd.PersistentFlags().Lookup("registry"))
+	viper.BindPFlag("CACHE_DIR", rootCmd.PersistentFlags().Lookup("cache"))
 	viper.BindPFlag("DEBUG", rootCmd.PersistentFlags().Lookup("debug"))
 
 	ioStreams := utils.NewStdIOStreams()
@@ -60,6 +72,12 @@ func init() {
 	rootCmd.AddCommand(
 		version.NewCmdVersion(io),
 		runCmd.NewCmdRun(io),
+		planCmd.NewCmdPlan(io),
+		syncCmd.NewCmdSync(io),
+		verifyCmd.NewCmdVerify(io),
+		rollbackCmd.NewCmdRollback(io),
+		exportCmd.NewCmdExport(io),
+		importCmd.NewCmdImport(io),
 		configCmd.NewCmdConfig(io),
 	)
 }
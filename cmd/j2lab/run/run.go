@@ -16,11 +16,15 @@ import (
 	"github.com/spf13/cobra"
 	"gitlab.com/infograb-public/j2lab/internal/config"
 	"gitlab.com/infograb-public/j2lab/internal/j2g"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/state"
 	"gitlab.com/infograb-public/j2lab/internal/utils"
 )
 
 type Options struct {
 	*utils.IOStreams
+
+	Resume bool
 }
 
 func NewOptions(ioStreams *utils.IOStreams) *Options {
@@ -42,6 +46,7 @@ func NewCmdRun(ioStreams *utils.IOStreams) *cobra.Command {
 		},
 	}
 
+	cmd.Flags().BoolVar(&o.Resume, "resume", false, "Skip the epics, issues and attachments recorded in the state file by a previous run")
 	return cmd
 }
 
@@ -59,7 +64,24 @@ func (o *Options) run() error {
 		return errors.Wrap(err, "Error getting config")
 	}
 
+	statePath, err := config.GetStatePath()
+	if err != nil {
+		return errors.Wrap(err, "Error getting state file path")
+	}
+
+	store, err := state.Open(statePath, o.Resume)
+	if err != nil {
+		return errors.Wrap(err, "Error opening state file")
+	}
+	defer store.Close()
+
 	gl := config.GetGitLabClient(cfg)
 	jr := config.GetJiraClient(cfg)
-	return j2g.ConvertByProject(gl, jr)
+	err = j2g.ConvertByProject(gl, jirax.NewClientSource(jr, cfg.IsJiraCloud()), store)
+
+	//* The skipped attachments are reported even if the run failed
+	if skipped := j2g.SkippedAttachments(); len(skipped) > 0 {
+		j2g.WriteSkippedAttachments(o.Out, skipped)
+	}
+	return err
 }
@@ -0,0 +1,83 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package sync
+
+import (
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/j2g"
+	"gitlab.com/infograb-public/j2lab/internal/state"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+type Options struct {
+	*utils.IOStreams
+}
+
+func NewOptions(ioStreams *utils.IOStreams) *Options {
+	return &Options{
+		IOStreams: ioStreams,
+	}
+}
+
+func NewCmdSync(ioStreams *utils.IOStreams) *cobra.Command {
+	o := NewOptions(ioStreams)
+	cmd := &cobra.Command{
+		Use:   "sync [options]",
+		Short: "Sync the Jira issues updated since the last run",
+		Long:  "Sync the Jira issues updated since the last successful run or sync recorded in the state file",
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckErr(o.complete(cmd, args))
+			utils.CheckErr(o.validate())
+			utils.CheckErr(o.run())
+		},
+	}
+
+	return cmd
+}
+
+func (o *Options) complete(cmd *cobra.Command, args []string) error {
+	return nil
+}
+
+func (o *Options) validate() error {
+	return nil
+}
+
+func (o *Options) run() error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	statePath, err := config.GetStatePath()
+	if err != nil {
+		return errors.Wrap(err, "Error getting state file path")
+	}
+
+	store, err := state.Open(statePath, true)
+	if err != nil {
+		return errors.Wrap(err, "Error opening state file")
+	}
+	defer store.Close()
+
+	gl := config.GetGitLabClient(cfg)
+	jr := config.GetJiraClient(cfg)
+	err = j2g.SyncByProject(gl, jr, store)
+
+	//* The skipped attachments are reported even if the run failed
+	if skipped := j2g.SkippedAttachments(); len(skipped) > 0 {
+		j2g.WriteSkippedAttachments(o.Out, skipped)
+	}
+	return err
+}
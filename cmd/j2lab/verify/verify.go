@@ -0,0 +1,99 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/j2g"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+type Options struct {
+	*utils.IOStreams
+
+	Output string
+}
+
+func NewOptions(ioStreams *utils.IOStreams) *Options {
+	return &Options{
+		IOStreams: ioStreams,
+		Output:    "text",
+	}
+}
+
+func NewCmdVerify(ioStreams *utils.IOStreams) *cobra.Command {
+	o := NewOptions(ioStreams)
+	cmd := &cobra.Command{
+		Use:   "verify [options]",
+		Short: "Compare the Jira project with GitLab after a run",
+		Long:  "Read the Jira project again and compare the epics, issues, comments, attachments, assignees, milestones, labels, states, parent epics and links with GitLab. Exit with 1 if anything does not match",
+		Run: func(cmd *cobra.Command, args []string) {
+			utils.CheckErr(o.complete(cmd, args))
+			utils.CheckErr(o.validate())
+			//* Exit with 1 on mismatches, without mixing an error in the JSON output
+			ok, err := o.run()
+			utils.CheckErr(err)
+			if err != nil || !ok {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.Output, "output", "o", o.Output, "One of 'text' or 'json'.")
+	return cmd
+}
+
+func (o *Options) complete(cmd *cobra.Command, args []string) error {
+	return nil
+}
+
+func (o *Options) validate() error {
+	if o.Output != "text" && o.Output != "json" {
+		return errors.Errorf("Invalid output format: %s", o.Output)
+	}
+	return nil
+}
+
+// run returns whether everything matches
+func (o *Options) run() (bool, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return false, errors.Wrap(err, "Error getting config")
+	}
+
+	gl := config.GetGitLabClient(cfg)
+	jr := config.GetJiraClient(cfg)
+
+	verification, err := j2g.NewVerification(gl, jr)
+	if err != nil {
+		return false, errors.Wrap(err, "Error verifying")
+	}
+
+	switch o.Output {
+	case "json":
+		result, err := json.MarshalIndent(verification, "", "  ")
+		if err != nil {
+			return false, errors.Wrap(err, "Error marshalling verification")
+		}
+		fmt.Fprintf(o.Out, "%s\n", result)
+	default:
+		verification.WriteText(o.Out)
+	}
+
+	return !verification.HasMismatches(), nil
+}
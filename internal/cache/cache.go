@@ -0,0 +1,151 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+// The cache is a content-addressed directory of the downloaded attachments,
+// so a file is downloaded once and shared by every run.
+// - objects/<sha256[:2]>/<sha256>: the file content
+// - attachments/<origin>/<Jira attachment ID>: the SHA-256 of the attachment content
+// The attachment IDs are only unique in their origin, the Jira site or the file of a backup or export.
+
+type Cache struct {
+	dir string
+}
+
+var (
+	cache *Cache
+	mutex sync.Mutex
+)
+
+// GetCache opens the cache directory of the config, it is created if it does not exist.
+func GetCache() (*Cache, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if cache != nil {
+		return cache, nil
+	}
+
+	dir, err := config.GetCachePath()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting cache directory")
+	}
+
+	cache, err = Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+func Open(dir string) (*Cache, error) {
+	for _, sub := range []string{"objects", "attachments", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error creating cache directory: %s", dir))
+		}
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Path returns the path of the content.
+func (c *Cache) Path(sum string) string {
+	return filepath.Join(c.dir, "objects", sum[:2], sum)
+}
+
+// Lookup returns the SHA-256 of the attachment of the origin if its content is in the cache.
+func (c *Cache) Lookup(origin string, id string) (string, bool) {
+	data, err := os.ReadFile(c.attachmentPath(origin, id))
+	if err != nil {
+		return "", false
+	}
+
+	sum := strings.TrimSpace(string(data))
+	if len(sum) != sha256.Size*2 || !utils.FileExists(c.Path(sum)) {
+		return "", false
+	}
+	return sum, true
+}
+
+// Add stores the attachment content of the origin and returns its SHA-256.
+// The content is written to a temporary file first, so an interrupted download is never used.
+func (c *Cache) Add(origin string, id string, reader io.Reader) (string, error) {
+	temp, err := os.CreateTemp(filepath.Join(c.dir, "tmp"), "download-")
+	if err != nil {
+		return "", errors.Wrap(err, "Error creating temporary file")
+	}
+	defer os.Remove(temp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(temp, hash), reader)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Error writing file")
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	path := c.Path(sum)
+	if !utils.FileExists(path) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return "", errors.Wrap(err, "Error creating cache directory")
+		}
+		if err := os.Rename(temp.Name(), path); err != nil {
+			return "", errors.Wrap(err, "Error moving file to cache")
+		}
+	}
+
+	index := c.attachmentPath(origin, id)
+	if err := os.MkdirAll(filepath.Dir(index), 0o755); err != nil {
+		return "", errors.Wrap(err, "Error creating cache directory")
+	}
+	if err := os.WriteFile(index, []byte(sum+"\n"), 0o644); err != nil {
+		return "", errors.Wrap(err, "Error writing cache index")
+	}
+	return sum, nil
+}
+
+// Open opens the content.
+func (c *Cache) Open(sum string) (*os.File, error) {
+	file, err := os.Open(c.Path(sum))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening cached file")
+	}
+	return file, nil
+}
+
+var unsafeOriginRegex = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// attachmentPath returns the index file of the attachment, the origin is reduced to a directory name
+func (c *Cache) attachmentPath(origin string, id string) string {
+	dir := strings.Trim(unsafeOriginRegex.ReplaceAllString(origin, "_"), "._")
+	if dir == "" {
+		dir = "_"
+	}
+	return filepath.Join(c.dir, "attachments", dir, filepath.Base(id))
+}
@@ -0,0 +1,64 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package cache
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := c.Lookup("jira.infograb.net", "10000"); ok {
+		t.Fatalf("Lookup() of a new cache found attachment 10000")
+	}
+
+	first, err := c.Add("jira.infograb.net", "10000", strings.NewReader("screenshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Add("jira.infograb.net", "10001", strings.NewReader("screenshot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "4441146b0fe1d5c6845af126ba5ce6003ea77d6b4cb04d14114f86a925c5dbca"; first != want || second != want {
+		t.Errorf("Add() of identical files = %s and %s, want %s", first, second, want)
+	}
+
+	sum, ok := c.Lookup("jira.infograb.net", "10001")
+	if !ok || sum != first {
+		t.Errorf("Lookup() = %s, %t, want %s, true", sum, ok, first)
+	}
+
+	//* The same attachment ID of another site or backup is another attachment
+	if _, ok := c.Lookup("/backup/entities.xml", "10001"); ok {
+		t.Errorf("Lookup() of another origin found attachment 10001")
+	}
+
+	file, err := c.Open(sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "screenshot" {
+		t.Errorf("Open() = %q, want %q", data, "screenshot")
+	}
+}
@@ -13,11 +13,13 @@ package config
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	"github.com/go-playground/validator"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
@@ -35,13 +37,18 @@ import (
 type Config struct {
 	Jira struct {
 		Host        string `yaml:"host" validate:"required,url"`
+		Flavor      string `yaml:"flavor" validate:"omitempty,oneof=cloud server"` //* Default server
+		Email       string `yaml:"email"`                                          //* Jira Cloud only, the owner of the API token
 		Token       string `yaml:"token" validate:"required"`
 		Name        string `yaml:"name" validate:"required"`
 		Jql         string `yaml:"jql"`
+		Board       int    `yaml:"board"`     //* Agile board to read the sprint list from
+		Changelog   bool   `yaml:"changelog"` //* Replay the change history as notes
 		CustomField struct {
 			StoryPoint    string `yaml:"story_point" mapstructure:"story_point"`
 			EpicStartDate string `yaml:"epic_start_date" mapstructure:"epic_start_date"`
 			ParentEpic    string `yaml:"parent_epic" mapstructure:"parent_epic"`
+			Sprint        string `yaml:"sprint" mapstructure:"sprint"`
 		} `yaml:"custom_field" mapstructure:"custom_field"`
 	} `yaml:"jira"`
 	GitLab struct {
@@ -49,11 +56,166 @@ type Config struct {
 		Token string `yaml:"token" validate:"required"`
 		Issue string `yaml:"issue" validate:"required" mapstructure:"issue"`
 		Epic  string `yaml:"epic" validate:"required" mapstructure:"epic"`
+
+		//* Project holding the epic attachments when the group uploads API is not available, default the issue project
+		Attachments string `yaml:"attachments" mapstructure:"attachments"`
+
+		//* Create epics, issues, comments and spent time as the mapped users, requires an administrator token
+		Impersonate bool `yaml:"impersonate" mapstructure:"impersonate"`
 	} `yaml:"gitlab"`
 
+	//* Attachments GitLab should not or cannot store
+	Attachment AttachmentPolicy `yaml:"attachment" mapstructure:"attachment"`
+
+	//* Jira Status Name -> GitLab label and state
+	StatusMap map[string]StatusMapping `yaml:"status_map" validate:"dive" mapstructure:"status_map"`
+
+	//* Jira Issue Type Name -> GitLab issue type and label
+	IssueTypeMap map[string]IssueTypeMapping `yaml:"issue_type_map" validate:"dive" mapstructure:"issue_type_map"`
+
+	//* Jira Issue Link Type Name -> GitLab link type
+	LinkTypeMap map[string]LinkTypeMapping `yaml:"link_type_map" validate:"dive" mapstructure:"link_type_map"`
+
 	Users map[string]int `yaml:"users" validate:"required" mapstructure:"users"`
 }
 
+// AttachmentPolicy decides which attachments are uploaded to GitLab.
+// - MaxSize: e.g. 512KB, 10MB or 1GB, default no limit. The files GitLab rejects as too large are handled the same
+// - Allow, Deny: extensions (.png) or MIME types (image/*), default all allowed. Deny wins over Allow
+// - Action: skip with a note, link to the Jira attachment or store in the external storage, default skip
+type AttachmentPolicy struct {
+	MaxSize string          `yaml:"max_size" mapstructure:"max_size"`
+	Allow   []string        `yaml:"allow" mapstructure:"allow"`
+	Deny    []string        `yaml:"deny" mapstructure:"deny"`
+	Action  string          `yaml:"action" validate:"omitempty,oneof=skip link store" mapstructure:"action"`
+	Store   AttachmentStore `yaml:"store" mapstructure:"store"`
+}
+
+// AttachmentStore is the local directory or S3-compatible bucket of the attachments not uploaded to GitLab.
+// - URL: base URL the stored files are linked from, default the file path or the bucket URL
+type AttachmentStore struct {
+	Dir string `yaml:"dir" mapstructure:"dir"`
+	URL string `yaml:"url" validate:"omitempty,url" mapstructure:"url"`
+	S3  struct {
+		Endpoint  string `yaml:"endpoint" validate:"omitempty,url" mapstructure:"endpoint"`
+		Region    string `yaml:"region" mapstructure:"region"` //* Default us-east-1
+		Bucket    string `yaml:"bucket" mapstructure:"bucket"`
+		Prefix    string `yaml:"prefix" mapstructure:"prefix"`
+		AccessKey string `yaml:"access_key" mapstructure:"access_key"`
+		SecretKey string `yaml:"secret_key" mapstructure:"secret_key"`
+	} `yaml:"s3" mapstructure:"s3"`
+}
+
+// MaxSizeBytes returns the maximum attachment size, 0 for no limit.
+func (p *AttachmentPolicy) MaxSizeBytes() int64 {
+	size, _ := ParseSize(p.MaxSize)
+	return size
+}
+
+// ParseSize parses a size in bytes with an optional KB, MB or GB unit of 1024.
+func ParseSize(s string) (int64, error) {
+	size := strings.ToUpper(strings.TrimSpace(s))
+	if size == "" {
+		return 0, nil
+	}
+
+	unit := int64(1)
+	for suffix, multiplier := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(size, suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, suffix))
+			unit = multiplier
+			break
+		}
+	}
+	size = strings.TrimSuffix(size, "B")
+
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil || value < 0 {
+		return 0, errors.New(fmt.Sprintf("invalid size %q, e.g. 10MB", s))
+	}
+	return int64(value * float64(unit)), nil
+}
+
+// StatusMapping is the GitLab label and state of a Jira status.
+// - Label: default status::<Jira Status Name>, empty for no label
+// - State: opened or closed, default closed if the Jira issue has a resolution
+type StatusMapping struct {
+	Label *string `yaml:"label" mapstructure:"label"`
+	State string  `yaml:"state" validate:"omitempty,oneof=opened closed" mapstructure:"state"`
+}
+
+// GetStatusMapping returns the mapping of the Jira status.
+// The status names are case insensitive because viper lowercases the map keys.
+func (c *Config) GetStatusMapping(status string) (*StatusMapping, bool) {
+	for name, mapping := range c.StatusMap {
+		if strings.EqualFold(name, status) {
+			return &mapping, true
+		}
+	}
+	return nil, false
+}
+
+// IssueTypeMapping is the GitLab issue type of a Jira issue type.
+// - Type: issue, incident, test_case or task, default issue. Sub-tasks mapped to task become child tasks of their parent issue.
+// - Label: whether to add the type::<Jira Issue Type Name> label, default true
+type IssueTypeMapping struct {
+	Type  string `yaml:"type" validate:"omitempty,oneof=issue incident test_case task" mapstructure:"type"`
+	Label *bool  `yaml:"label" mapstructure:"label"`
+}
+
+// GetIssueTypeMapping returns the mapping of the Jira issue type.
+// The issue type names are case insensitive because viper lowercases the map keys.
+func (c *Config) GetIssueTypeMapping(issueType string) (*IssueTypeMapping, bool) {
+	for name, mapping := range c.IssueTypeMap {
+		if strings.EqualFold(name, issueType) {
+			return &mapping, true
+		}
+	}
+	return nil, false
+}
+
+// LinkTypeMapping is the GitLab link type of a Jira issue link type.
+// - Type: relates_to, blocks or is_blocked_by, read from the outward issue, e.g. A blocks B for the Jira outward description "blocks"
+type LinkTypeMapping struct {
+	Type string `yaml:"type" validate:"required,oneof=relates_to blocks is_blocked_by" mapstructure:"type"`
+}
+
+// GetLinkTypeMapping returns the mapping of the Jira issue link type.
+// The link type names are case insensitive because viper lowercases the map keys.
+func (c *Config) GetLinkTypeMapping(linkType string) (*LinkTypeMapping, bool) {
+	for name, mapping := range c.LinkTypeMap {
+		if strings.EqualFold(name, linkType) {
+			return &mapping, true
+		}
+	}
+	return nil, false
+}
+
+// AttachmentProject returns the project of the epic attachments uploaded without the group uploads API.
+func (c *Config) AttachmentProject() string {
+	if c.GitLab.Attachments != "" {
+		return c.GitLab.Attachments
+	}
+	return c.GitLab.Issue
+}
+
+// IsJiraCloud returns whether the Jira site is a Jira Cloud site instead of Jira Server or Data Center.
+func (c *Config) IsJiraCloud() bool {
+	return c.Jira.Flavor == "cloud"
+}
+
+// JiraUserKey returns the identity of the Jira user used in user.csv and in mentions.
+// Jira Cloud identifies users with their account ID, Jira Server with their username.
+func (c *Config) JiraUserKey(user *jira.User) string {
+	if user == nil {
+		return ""
+	}
+	if c.IsJiraCloud() {
+		return user.AccountID
+	}
+	return user.Name
+}
+
 var cfg *Config
 
 func capitalizeJiraProject(cfg *Config) {
@@ -89,6 +251,12 @@ func GetConfig() (*Config, error) {
 			cfg.GitLab.Token = value
 		case "JIRA_TOKEN":
 			cfg.Jira.Token = value
+		case "JIRA_EMAIL":
+			cfg.Jira.Email = value
+		case "AWS_ACCESS_KEY_ID":
+			cfg.Attachment.Store.S3.AccessKey = value
+		case "AWS_SECRET_ACCESS_KEY":
+			cfg.Attachment.Store.S3.SecretKey = value
 		}
 	}
 
@@ -103,6 +271,18 @@ func GetConfig() (*Config, error) {
 	if err := validate.Struct(cfg); err != nil {
 		return nil, errors.Wrap(err, "Error validating config")
 	}
+	if cfg.IsJiraCloud() && cfg.Jira.Email == "" {
+		return nil, errors.New("Error validating config: jira.email is required for Jira Cloud")
+	}
+	if _, err := ParseSize(cfg.Attachment.MaxSize); err != nil {
+		return nil, errors.Wrap(err, "Error validating config: attachment.max_size")
+	}
+	if cfg.Attachment.Action == "store" && cfg.Attachment.Store.Dir == "" && cfg.Attachment.Store.S3.Bucket == "" {
+		return nil, errors.New("Error validating config: attachment.store.dir or attachment.store.s3 is required to store attachments")
+	}
+	if cfg.Attachment.Store.S3.Bucket != "" && cfg.Attachment.Store.S3.Endpoint == "" {
+		return nil, errors.New("Error validating config: attachment.store.s3.endpoint is required")
+	}
 
 	return cfg, nil
 }
@@ -142,6 +322,44 @@ func InitConfig() error {
 	return nil
 }
 
+// The state file records every GitLab object created by the migration.
+// You can add --state option to specify the state file
+// If you don't specify the state file, it is stored next to the config file
+func GetStatePath() (string, error) {
+	return pathNextToConfig("STATE_FILE", "j2lab.state.jsonl")
+}
+
+// The registry file records the epics and issues of every migrated Jira project and the links between projects.
+// You can add --registry option to share it between the configs of several projects
+// If you don't specify the registry file, it is stored next to the config file
+func GetRegistryPath() (string, error) {
+	return pathNextToConfig("REGISTRY_FILE", "j2lab.registry.jsonl")
+}
+
+// The cache directory keeps the downloaded attachments between runs.
+// You can add --cache option to specify the cache directory
+// If you don't specify the cache directory, it is stored next to the config file
+func GetCachePath() (string, error) {
+	return pathNextToConfig("CACHE_DIR", "j2lab.cache")
+}
+
+// pathNextToConfig returns the path of the key, else the name next to the config file or in the working directory.
+func pathNextToConfig(key string, name string) (string, error) {
+	if path := viper.GetString(key); path != "" {
+		return filepath.Abs(path)
+	}
+
+	if configFile := viper.ConfigFileUsed(); configFile != "" {
+		return filepath.Join(filepath.Dir(configFile), name), nil
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return "", errors.Wrap(err, "Error getting current working directory")
+	}
+	return filepath.Join(pwd, name), nil
+}
+
 func parseUserCSVs() (map[string]int, error) {
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -13,6 +13,7 @@ package config
 
 import (
 	"context"
+	"net/http"
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	log "github.com/sirupsen/logrus"
@@ -25,11 +26,22 @@ func GetJiraClient(cfg *Config) *jira.Client {
 		return jiraClient
 	}
 
-	tp := jira.BearerAuthTransport{
-		Token: cfg.Jira.Token,
+	//* Jira Cloud uses the email and an API token, Jira Server a personal access token
+	var httpClient *http.Client
+	if cfg.IsJiraCloud() {
+		tp := jira.BasicAuthTransport{
+			Username: cfg.Jira.Email,
+			Password: cfg.Jira.Token,
+		}
+		httpClient = tp.Client()
+	} else {
+		tp := jira.BearerAuthTransport{
+			Token: cfg.Jira.Token,
+		}
+		httpClient = tp.Client()
 	}
 
-	client, err := jira.NewClient(cfg.Jira.Host, tp.Client())
+	client, err := jira.NewClient(cfg.Jira.Host, httpClient)
 	if err != nil {
 		log.Fatalf("Error creating Jira client: %s", err)
 	}
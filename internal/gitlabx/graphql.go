@@ -0,0 +1,80 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package gitlabx
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+//* 라이브러리에서 지원하지 않는 GraphQL API
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// GraphQL sends the query to the GraphQL API of the GitLab instance and decodes the data into v.
+func GraphQL(gl *gitlab.Client, query string, variables map[string]interface{}, v interface{}, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	req, err := gl.NewRequest(http.MethodPost, "", &graphQLRequest{query, variables}, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+
+	//* The GraphQL endpoint is /api/graphql next to /api/v4
+	u := gl.BaseURL()
+	u.Path = strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), "/v4") + "/graphql"
+	u.RawPath = ""
+	req.URL = u
+
+	result := new(graphQLResponse)
+	resp, err := gl.Do(req, result)
+	if err != nil {
+		return resp, errors.Wrap(err, "Error making request")
+	}
+
+	if len(result.Errors) > 0 {
+		messages := []string{}
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return resp, errors.New(fmt.Sprintf("GraphQL error: %s", strings.Join(messages, ", ")))
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(result.Data, v); err != nil {
+			return resp, errors.Wrap(err, "Error decoding GraphQL data")
+		}
+	}
+
+	return resp, nil
+}
+
+// mutationErrors checks the errors field returned by GraphQL mutations
+func mutationErrors(name string, errs []string) error {
+	if len(errs) > 0 {
+		return errors.New(fmt.Sprintf("%s: %s", name, strings.Join(errs, ", ")))
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package gitlabx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+//* Iterations can only be created and assigned with the GraphQL API
+
+func IterationGID(iterationID int) string {
+	return fmt.Sprintf("gid://gitlab/Iteration/%d", iterationID)
+}
+
+// parseGID returns the numeric ID of a global ID such as gid://gitlab/Iteration/1
+func parseGID(gid string) (int, error) {
+	id, err := strconv.Atoi(gid[strings.LastIndex(gid, "/")+1:])
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("Error parsing global ID: %s", gid))
+	}
+	return id, nil
+}
+
+// GetOrCreateIterationCadence returns the global ID of the manual iteration cadence of the group with the title.
+func GetOrCreateIterationCadence(gl *gitlab.Client, groupPath string, title string, options ...gitlab.RequestOptionFunc) (string, error) {
+	query := `query($fullPath: ID!, $title: String) {
+  group(fullPath: $fullPath) {
+    iterationCadences(title: $title, includeAncestorGroups: true) {
+      nodes {
+        id
+        title
+      }
+    }
+  }
+}`
+
+	data := struct {
+		Group *struct {
+			IterationCadences struct {
+				Nodes []struct {
+					ID    string `json:"id"`
+					Title string `json:"title"`
+				} `json:"nodes"`
+			} `json:"iterationCadences"`
+		} `json:"group"`
+	}{}
+
+	_, err := GraphQL(gl, query, map[string]interface{}{
+		"fullPath": groupPath,
+		"title":    title,
+	}, &data, options...)
+	if err != nil {
+		return "", errors.Wrap(err, "Error listing iteration cadences")
+	}
+	if data.Group == nil {
+		return "", errors.New(fmt.Sprintf("Group not found: %s", groupPath))
+	}
+
+	for _, cadence := range data.Group.IterationCadences.Nodes {
+		if cadence.Title == title {
+			return cadence.ID, nil
+		}
+	}
+
+	mutation := `mutation($groupPath: ID!, $title: String) {
+  iterationCadenceCreate(input: {groupPath: $groupPath, title: $title, automatic: false, active: true}) {
+    iterationCadence {
+      id
+    }
+    errors
+  }
+}`
+
+	created := struct {
+		IterationCadenceCreate struct {
+			IterationCadence *struct {
+				ID string `json:"id"`
+			} `json:"iterationCadence"`
+			Errors []string `json:"errors"`
+		} `json:"iterationCadenceCreate"`
+	}{}
+
+	_, err = GraphQL(gl, mutation, map[string]interface{}{
+		"groupPath": groupPath,
+		"title":     title,
+	}, &created, options...)
+	if err != nil {
+		return "", errors.Wrap(err, "Error creating iteration cadence")
+	}
+	if err := mutationErrors("iterationCadenceCreate", created.IterationCadenceCreate.Errors); err != nil {
+		return "", err
+	}
+
+	return created.IterationCadenceCreate.IterationCadence.ID, nil
+}
+
+type CreateIterationOptions struct {
+	CadenceID   string
+	Title       string
+	Description string
+	StartDate   time.Time
+	DueDate     time.Time
+}
+
+// CreateIteration creates an iteration in the cadence of the group.
+func CreateIteration(gl *gitlab.Client, groupPath string, opt *CreateIterationOptions, options ...gitlab.RequestOptionFunc) (*gitlab.GroupIteration, *gitlab.Response, error) {
+	mutation := `mutation($groupPath: ID!, $cadenceId: IterationsCadenceID, $title: String, $description: String, $startDate: String, $dueDate: String) {
+  iterationCreate(input: {groupPath: $groupPath, iterationsCadenceId: $cadenceId, title: $title, description: $description, startDate: $startDate, dueDate: $dueDate}) {
+    iteration {
+      id
+      iid
+      title
+      description
+      state
+      webUrl
+    }
+    errors
+  }
+}`
+
+	data := struct {
+		IterationCreate struct {
+			Iteration *struct {
+				ID          string `json:"id"`
+				IID         string `json:"iid"`
+				Title       string `json:"title"`
+				Description string `json:"description"`
+				State       string `json:"state"`
+				WebURL      string `json:"webUrl"`
+			} `json:"iteration"`
+			Errors []string `json:"errors"`
+		} `json:"iterationCreate"`
+	}{}
+
+	resp, err := GraphQL(gl, mutation, map[string]interface{}{
+		"groupPath":   groupPath,
+		"cadenceId":   opt.CadenceID,
+		"title":       opt.Title,
+		"description": opt.Description,
+		"startDate":   opt.StartDate.Format("2006-01-02"),
+		"dueDate":     opt.DueDate.Format("2006-01-02"),
+	}, &data, options...)
+	if err != nil {
+		return nil, resp, errors.Wrap(err, "Error creating iteration")
+	}
+	if err := mutationErrors("iterationCreate", data.IterationCreate.Errors); err != nil {
+		return nil, resp, err
+	}
+
+	created := data.IterationCreate.Iteration
+	id, err := parseGID(created.ID)
+	if err != nil {
+		return nil, resp, err
+	}
+	iid, _ := strconv.Atoi(created.IID)
+
+	startDate := gitlab.ISOTime(opt.StartDate)
+	dueDate := gitlab.ISOTime(opt.DueDate)
+	return &gitlab.GroupIteration{
+		ID:          id,
+		IID:         iid,
+		Title:       created.Title,
+		Description: created.Description,
+		StartDate:   &startDate,
+		DueDate:     &dueDate,
+		WebURL:      created.WebURL,
+	}, resp, nil
+}
+
+// SetIssueIteration assigns the issue to the iteration.
+func SetIssueIteration(gl *gitlab.Client, projectPath string, issueIID int, iterationID int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	mutation := `mutation($projectPath: ID!, $iid: String!, $iterationId: IterationID) {
+  issueSetIteration(input: {projectPath: $projectPath, iid: $iid, iterationId: $iterationId}) {
+    errors
+  }
+}`
+
+	data := struct {
+		IssueSetIteration struct {
+			Errors []string `json:"errors"`
+		} `json:"issueSetIteration"`
+	}{}
+
+	resp, err := GraphQL(gl, mutation, map[string]interface{}{
+		"projectPath": projectPath,
+		"iid":         strconv.Itoa(issueIID),
+		"iterationId": IterationGID(iterationID),
+	}, &data, options...)
+	if err != nil {
+		return resp, errors.Wrap(err, "Error setting issue iteration")
+	}
+
+	return resp, mutationErrors("issueSetIteration", data.IssueSetIteration.Errors)
+}
+
+// DeleteIteration deletes the iteration.
+func DeleteIteration(gl *gitlab.Client, iterationID int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	mutation := `mutation($id: IterationID!) {
+  iterationDelete(input: {id: $id}) {
+    errors
+  }
+}`
+
+	data := struct {
+		IterationDelete struct {
+			Errors []string `json:"errors"`
+		} `json:"iterationDelete"`
+	}{}
+
+	resp, err := GraphQL(gl, mutation, map[string]interface{}{
+		"id": IterationGID(iterationID),
+	}, &data, options...)
+	if err != nil {
+		return resp, errors.Wrap(err, "Error deleting iteration")
+	}
+
+	return resp, mutationErrors("iterationDelete", data.IterationDelete.Errors)
+}
@@ -0,0 +1,133 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package gitlabx
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+//* The REST API can not set the date and the summary of a spent time
+
+func IssueGID(issueID int) string {
+	return fmt.Sprintf("gid://gitlab/Issue/%d", issueID)
+}
+
+type Timelog struct {
+	SpentAt   time.Time `json:"spentAt"`
+	TimeSpent int       `json:"timeSpent"` //* Seconds
+	Summary   string    `json:"summary"`
+	User      struct {
+		Username string `json:"username"`
+	} `json:"user"`
+}
+
+// ListIssueTimelogs returns every spent time of the issue.
+func ListIssueTimelogs(gl *gitlab.Client, projectPath string, issueIID int, options ...gitlab.RequestOptionFunc) ([]*Timelog, error) {
+	query := `query($fullPath: ID!, $iid: String!, $after: String) {
+  project(fullPath: $fullPath) {
+    issue(iid: $iid) {
+      timelogs(first: 100, after: $after) {
+        pageInfo {
+          hasNextPage
+          endCursor
+        }
+        nodes {
+          spentAt
+          timeSpent
+          summary
+          user {
+            username
+          }
+        }
+      }
+    }
+  }
+}`
+
+	result := []*Timelog{}
+	var after *string
+	for {
+		data := struct {
+			Project *struct {
+				Issue *struct {
+					Timelogs struct {
+						PageInfo struct {
+							HasNextPage bool   `json:"hasNextPage"`
+							EndCursor   string `json:"endCursor"`
+						} `json:"pageInfo"`
+						Nodes []*Timelog `json:"nodes"`
+					} `json:"timelogs"`
+				} `json:"issue"`
+			} `json:"project"`
+		}{}
+
+		_, err := GraphQL(gl, query, map[string]interface{}{
+			"fullPath": projectPath,
+			"iid":      strconv.Itoa(issueIID),
+			"after":    after,
+		}, &data, options...)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error listing timelogs")
+		}
+		if data.Project == nil || data.Project.Issue == nil {
+			return nil, errors.New(fmt.Sprintf("Issue not found: %s#%d", projectPath, issueIID))
+		}
+
+		timelogs := data.Project.Issue.Timelogs
+		result = append(result, timelogs.Nodes...)
+		if !timelogs.PageInfo.HasNextPage {
+			break
+		}
+		after = &timelogs.PageInfo.EndCursor
+	}
+
+	return result, nil
+}
+
+type CreateTimelogOptions struct {
+	TimeSpent int //* Seconds
+	SpentAt   time.Time
+	Summary   string
+}
+
+// CreateIssueTimelog adds a spent time to the issue.
+// The time is spent by the user of the token, or by the user of gitlab.WithSudo.
+func CreateIssueTimelog(gl *gitlab.Client, issueID int, opt *CreateTimelogOptions, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	mutation := `mutation($issuableId: IssuableID!, $timeSpent: String!, $spentAt: Time!, $summary: String!) {
+  timelogCreate(input: {issuableId: $issuableId, timeSpent: $timeSpent, spentAt: $spentAt, summary: $summary}) {
+    errors
+  }
+}`
+
+	data := struct {
+		TimelogCreate struct {
+			Errors []string `json:"errors"`
+		} `json:"timelogCreate"`
+	}{}
+
+	resp, err := GraphQL(gl, mutation, map[string]interface{}{
+		"issuableId": IssueGID(issueID),
+		"timeSpent":  fmt.Sprintf("%ds", opt.TimeSpent),
+		"spentAt":    opt.SpentAt.Format(time.RFC3339),
+		"summary":    opt.Summary,
+	}, &data, options...)
+	if err != nil {
+		return resp, errors.Wrap(err, "Error creating timelog")
+	}
+
+	return resp, mutationErrors("timelogCreate", data.TimelogCreate.Errors)
+}
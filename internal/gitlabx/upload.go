@@ -0,0 +1,105 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package gitlabx
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// DeleteProjectUpload deletes the file uploaded to the project by its URL, /uploads/:secret/:filename.
+func DeleteProjectUpload(gl *gitlab.Client, pid interface{}, url string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	project, err := parseID(pid)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing ID")
+	}
+
+	secret, filename, err := parseUploadURL(url)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("projects/%s/uploads/%s/%s", gitlab.PathEscape(project), secret, gitlab.PathEscape(filename))
+
+	req, err := gl.NewRequest(http.MethodDelete, u, nil, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+
+	resp, err := gl.Do(req, nil)
+	if err != nil {
+		return resp, errors.Wrap(err, "Error making request")
+	}
+
+	return resp, nil
+}
+
+// UploadGroupFile uploads a file to the group, the Markdown links to /uploads/:secret/:filename under the group URL.
+// GitLab versions without the group uploads API answer 404 or 405.
+func UploadGroupFile(gl *gitlab.Client, gid interface{}, content io.Reader, filename string, options ...gitlab.RequestOptionFunc) (*gitlab.ProjectFile, *gitlab.Response, error) {
+	group, err := parseID(gid)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error parsing ID")
+	}
+	u := fmt.Sprintf("groups/%s/uploads", gitlab.PathEscape(group))
+
+	req, err := gl.UploadRequest(http.MethodPost, u, content, filename, gitlab.UploadFile, nil, options)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error creating request")
+	}
+
+	file := new(gitlab.ProjectFile)
+	resp, err := gl.Do(req, file)
+	if err != nil {
+		return nil, resp, errors.Wrap(err, "Error making request")
+	}
+
+	return file, resp, nil
+}
+
+// DeleteGroupUpload deletes the file uploaded to the group by its URL, /uploads/:secret/:filename.
+func DeleteGroupUpload(gl *gitlab.Client, gid interface{}, url string, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	group, err := parseID(gid)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing ID")
+	}
+
+	secret, filename, err := parseUploadURL(url)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("groups/%s/uploads/%s/%s", gitlab.PathEscape(group), secret, gitlab.PathEscape(filename))
+
+	req, err := gl.NewRequest(http.MethodDelete, u, nil, options)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+
+	resp, err := gl.Do(req, nil)
+	if err != nil {
+		return resp, errors.Wrap(err, "Error making request")
+	}
+
+	return resp, nil
+}
+
+func parseUploadURL(url string) (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(url, "/uploads/"), "/")
+	if !strings.HasPrefix(url, "/uploads/") || len(parts) != 2 {
+		return "", "", errors.New(fmt.Sprintf("Invalid upload URL: %s", url))
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,49 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package gitlabx
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// WorkItemGID returns the global ID of the work item of an issue. Issues and work items share the same ID.
+func WorkItemGID(issueID int) string {
+	return fmt.Sprintf("gid://gitlab/WorkItem/%d", issueID)
+}
+
+// SetWorkItemParent makes the issue a child of the parent issue, e.g. a task of an issue.
+func SetWorkItemParent(gl *gitlab.Client, issueID int, parentIssueID int, options ...gitlab.RequestOptionFunc) (*gitlab.Response, error) {
+	query := `mutation($id: WorkItemID!, $parentId: WorkItemID) {
+  workItemUpdate(input: {id: $id, hierarchyWidget: {parentId: $parentId}}) {
+    errors
+  }
+}`
+
+	data := struct {
+		WorkItemUpdate struct {
+			Errors []string `json:"errors"`
+		} `json:"workItemUpdate"`
+	}{}
+
+	resp, err := GraphQL(gl, query, map[string]interface{}{
+		"id":       WorkItemGID(issueID),
+		"parentId": WorkItemGID(parentIssueID),
+	}, &data, options...)
+	if err != nil {
+		return resp, errors.Wrap(err, "Error updating work item")
+	}
+
+	return resp, mutationErrors("workItemUpdate", data.WorkItemUpdate.Errors)
+}
@@ -0,0 +1,427 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// Jira Cloud REST API v3 returns the descriptions and the comments in the Atlassian Document Format (ADF),
+// a JSON tree of nodes: https://developer.atlassian.com/cloud/jira/platform/apis/document/structure/
+
+type adfNode struct {
+	Type    string                 `json:"type"`
+	Attrs   map[string]interface{} `json:"attrs,omitempty"`
+	Content []*adfNode             `json:"content,omitempty"`
+	Text    string                 `json:"text,omitempty"`
+	Marks   []*adfMark             `json:"marks,omitempty"`
+}
+
+type adfMark struct {
+	Type  string                 `json:"type"`
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+func (n *adfNode) attr(key string) string {
+	switch v := n.Attrs[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (m *adfMark) attr(key string) string {
+	if v, ok := m.Attrs[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// Jira panel type -> GitLab alert type
+var adfPanelAlerts = map[string]string{
+	"info":    "note",
+	"note":    "note",
+	"tip":     "tip",
+	"success": "tip",
+	"warning": "warning",
+	"error":   "caution",
+}
+
+func parseADF(doc string) (*adfNode, error) {
+	root := new(adfNode)
+	if err := json.Unmarshal([]byte(doc), root); err != nil {
+		return nil, errors.Wrap(err, "Error parsing ADF document")
+	}
+	return root, nil
+}
+
+// ADFToMD converts an ADF document to GitLab Markdown like JiraToMD converts wiki markup.
+// It returns the Markdown and the filenames of the attachments used in the document.
+func ADFToMD(doc string, attachments AttachmentMap, userMap UserMap) (string, []string, error) {
+	if strings.TrimSpace(doc) == "" {
+		return "", []string{}, nil
+	}
+
+	root, err := parseADF(doc)
+	if err != nil {
+		return "", nil, err
+	}
+
+	r := &adfRenderer{attachments: attachments, userMap: userMap, usedAttachments: []string{}}
+	return strings.TrimSpace(r.blocks(root.Content, "\n\n")), r.usedAttachments, nil
+}
+
+// adfMentions returns the account IDs mentioned in an ADF document
+func adfMentions(doc string) []string {
+	if strings.TrimSpace(doc) == "" {
+		return nil
+	}
+
+	root, err := parseADF(doc)
+	if err != nil {
+		log.Debugf("Unable to find mentions: %v", err)
+		return nil
+	}
+
+	result := []string{}
+	var walk func(n *adfNode)
+	walk = func(n *adfNode) {
+		if n.Type == "mention" && n.attr("id") != "" {
+			result = append(result, n.attr("id"))
+		}
+		for _, child := range n.Content {
+			walk(child)
+		}
+	}
+	walk(root)
+	return result
+}
+
+type adfRenderer struct {
+	attachments     AttachmentMap
+	userMap         UserMap
+	usedAttachments []string
+}
+
+func (r *adfRenderer) blocks(nodes []*adfNode, sep string) string {
+	result := []string{}
+	for _, n := range nodes {
+		if block := r.block(n); block != "" {
+			result = append(result, block)
+		}
+	}
+	return strings.Join(result, sep)
+}
+
+func (r *adfRenderer) block(n *adfNode) string {
+	switch n.Type {
+	case "paragraph":
+		return r.inline(n.Content)
+	case "heading":
+		level, _ := strconv.Atoi(n.attr("level"))
+		if level < 1 || level > 6 {
+			level = 1
+		}
+		return strings.Repeat("#", level) + " " + r.inline(n.Content)
+	case "bulletList":
+		return r.list(n, func(int) string { return "* " })
+	case "orderedList":
+		start, err := strconv.Atoi(n.attr("order"))
+		if err != nil {
+			start = 1
+		}
+		return r.list(n, func(i int) string { return fmt.Sprintf("%d. ", start+i) })
+	case "taskList":
+		return r.list(n, func(int) string { return "" })
+	case "decisionList":
+		return r.list(n, func(int) string { return "* " })
+	case "codeBlock":
+		text := ""
+		for _, child := range n.Content {
+			text += child.Text
+		}
+		return fmt.Sprintf("```%s\n%s\n```", n.attr("language"), text)
+	case "blockquote":
+		return prefixLines(r.blocks(n.Content, "\n\n"), "> ", "> ")
+	case "rule":
+		return "---"
+	case "panel":
+		alert, ok := adfPanelAlerts[n.attr("panelType")]
+		if !ok {
+			alert = "note"
+		}
+		return fmt.Sprintf("> [!%s]\n", alert) + prefixLines(r.blocks(n.Content, "\n\n"), "> ", "> ")
+	case "expand", "nestedExpand":
+		title := n.attr("title")
+		if title == "" {
+			title = "Details"
+		}
+		return fmt.Sprintf("<details><summary>%s</summary>\n\n%s\n\n</details>", title, r.blocks(n.Content, "\n\n"))
+	case "table":
+		return r.table(n)
+	case "mediaSingle", "mediaGroup":
+		result := []string{}
+		for _, child := range n.Content {
+			result = append(result, r.media(child))
+		}
+		return strings.Join(result, "\n")
+	case "media":
+		return r.media(n)
+	case "blockCard", "embedCard":
+		return fmt.Sprintf("<%s>", n.attr("url"))
+	case "text", "hardBreak", "mention", "emoji", "status", "inlineCard", "date", "mediaInline":
+		return r.inline([]*adfNode{n})
+	default:
+		log.Debugf("Unknown ADF node: %s", n.Type)
+		return r.blocks(n.Content, "\n\n")
+	}
+}
+
+// list renders the items of a list, the nested blocks are indented under their item
+func (r *adfRenderer) list(n *adfNode, bullet func(int) string) string {
+	result := []string{}
+	for i, item := range n.Content {
+		prefix := bullet(i)
+		var content string
+		switch item.Type {
+		case "taskItem":
+			if item.attr("state") == "DONE" {
+				prefix = "- [x] "
+			} else {
+				prefix = "- [ ] "
+			}
+			content = r.taskItem(item)
+		case "decisionItem":
+			content = r.inline(item.Content)
+		case "taskList":
+			//* A nested task list is a sibling of its parent item
+			result = append(result, prefixLines(r.block(item), "  ", "  "))
+			continue
+		default:
+			content = r.blocks(item.Content, "\n")
+		}
+		result = append(result, prefixLines(content, prefix, strings.Repeat(" ", len(prefix))))
+	}
+	return strings.Join(result, "\n")
+}
+
+// The content of a task item is inline nodes
+func (r *adfRenderer) taskItem(n *adfNode) string {
+	inline := []*adfNode{}
+	blocks := []string{}
+	for _, child := range n.Content {
+		switch child.Type {
+		case "taskList", "bulletList", "orderedList", "paragraph":
+			if len(inline) > 0 {
+				blocks = append(blocks, r.inline(inline))
+				inline = []*adfNode{}
+			}
+			blocks = append(blocks, r.block(child))
+		default:
+			inline = append(inline, child)
+		}
+	}
+	if len(inline) > 0 {
+		blocks = append(blocks, r.inline(inline))
+	}
+	return strings.Join(blocks, "\n")
+}
+
+func (r *adfRenderer) table(n *adfNode) string {
+	rows := [][]string{}
+	columns := 0
+	for _, row := range n.Content {
+		cells := []string{}
+		for _, cell := range row.Content {
+			content := r.blocks(cell.Content, "<br>")
+			content = strings.ReplaceAll(content, "\n", "<br>")
+			content = strings.ReplaceAll(content, "|", "\\|")
+			if content == "" {
+				content = " "
+			}
+			cells = append(cells, content)
+		}
+		if len(cells) > columns {
+			columns = len(cells)
+		}
+		rows = append(rows, cells)
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	formatRow := func(cells []string) string {
+		for len(cells) < columns {
+			cells = append(cells, " ")
+		}
+		return "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	result := []string{formatRow(rows[0])}
+	separator := make([]string, columns)
+	for i := range separator {
+		separator[i] = "---"
+	}
+	result = append(result, formatRow(separator))
+	for _, row := range rows[1:] {
+		result = append(result, formatRow(row))
+	}
+	return strings.Join(result, "\n")
+}
+
+// The media of Jira Cloud are found by their filename in the alt attribute
+func (r *adfRenderer) media(n *adfNode) string {
+	if n.attr("type") == "external" {
+		return fmt.Sprintf("![%s](%s)", n.attr("alt"), n.attr("url"))
+	}
+
+	name := n.attr("alt")
+	if attachment, ok := r.attachments[name]; ok {
+		r.usedAttachments = append(r.usedAttachments, name)
+
+		width, height := n.attr("width"), n.attr("height")
+		if strings.HasPrefix(attachment.Markdown, "!") && (width != "" || height != "") {
+			metadata := ""
+			if width != "" {
+				metadata += fmt.Sprintf(" width=\"%s\"", width)
+			}
+			if height != "" {
+				metadata += fmt.Sprintf(" height=\"%s\"", height)
+			}
+			return fmt.Sprintf(`<img src="%s" alt="%s"%s>`, attachment.URL, attachment.Alt, metadata)
+		}
+		return attachment.Markdown
+	}
+
+	log.Debugf("attachment not found: %s (%s)", name, n.attr("id"))
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf("![%s](%s)", name, name)
+}
+
+func (r *adfRenderer) inline(nodes []*adfNode) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		switch n.Type {
+		case "text":
+			b.WriteString(applyADFMarks(n.Text, n.Marks))
+		case "hardBreak":
+			b.WriteString("\n")
+		case "mention":
+			if user, ok := r.userMap[n.attr("id")]; ok {
+				b.WriteString("@" + user.Username)
+			} else {
+				log.Debugf("user not found: %s", n.attr("id"))
+				b.WriteString(n.attr("text"))
+			}
+		case "emoji":
+			if text := n.attr("text"); text != "" {
+				b.WriteString(text)
+			} else {
+				b.WriteString(n.attr("shortName"))
+			}
+		case "status":
+			b.WriteString(fmt.Sprintf("`%s`", strings.ToUpper(n.attr("text"))))
+		case "inlineCard":
+			b.WriteString(fmt.Sprintf("<%s>", n.attr("url")))
+		case "date":
+			if ms, err := strconv.ParseInt(n.attr("timestamp"), 10, 64); err == nil {
+				b.WriteString(time.UnixMilli(ms).UTC().Format("2006-01-02"))
+			}
+		case "mediaInline":
+			b.WriteString(r.media(n))
+		case "placeholder":
+		default:
+			b.WriteString(r.block(n))
+		}
+	}
+	return b.String()
+}
+
+func applyADFMarks(text string, marks []*adfMark) string {
+	if text == "" {
+		return text
+	}
+
+	//* Markdown emphasis must not start or end with a space
+	trimmed := strings.TrimFunc(text, unicode.IsSpace)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	before, after := text[:start], text[start+len(trimmed):]
+
+	result := trimmed
+	//* Code first, so that the other marks are outside of the backticks
+	for _, mark := range marks {
+		if mark.Type == "code" {
+			result = "`" + result + "`"
+		}
+	}
+	for _, mark := range marks {
+		switch mark.Type {
+		case "strong":
+			result = "**" + result + "**"
+		case "em":
+			result = "*" + result + "*"
+		case "strike":
+			result = "~~" + result + "~~"
+		case "underline":
+			result = "<ins>" + result + "</ins>"
+		case "subsup":
+			if mark.attr("type") == "sup" {
+				result = "<sup>" + result + "</sup>"
+			} else {
+				result = "<sub>" + result + "</sub>"
+			}
+		}
+	}
+	for _, mark := range marks {
+		if mark.Type == "link" {
+			result = fmt.Sprintf("[%s](%s)", result, mark.attr("href"))
+		}
+	}
+
+	return before + result + after
+}
+
+// prefixLines prefixes the first line with first and the other lines with rest.
+// Empty lines are prefixed without the trailing spaces.
+func prefixLines(s string, first string, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		prefix := rest
+		if i == 0 {
+			prefix = first
+		}
+		if line == "" {
+			lines[i] = strings.TrimRight(prefix, " ")
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
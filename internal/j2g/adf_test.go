@@ -0,0 +1,84 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Update the golden files with: go test ./internal/j2g -run TestADFToMD -update
+var update = flag.Bool("update", false, "update the golden files")
+
+var adfAttachments = AttachmentMap{
+	"SCR-20230906-oflk.png": &Attachment{
+		Markdown: "![SCR-20230906-oflk.png](/uploads/def/SCR-20230906-oflk.png)",
+		Filename: "SCR-20230906-oflk.png",
+		Alt:      "SCR-20230906-oflk.png",
+		URL:      "/uploads/def/SCR-20230906-oflk.png",
+	},
+	"SCR-20230906-ofnz.png": &Attachment{
+		Markdown: "![SCR-20230906-ofnz.png](/uploads/abc/SCR-20230906-ofnz.png)",
+		Filename: "SCR-20230906-ofnz.png",
+		Alt:      "SCR-20230906-ofnz.png",
+		URL:      "/uploads/abc/SCR-20230906-ofnz.png",
+	},
+}
+
+func TestADFToMD(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "adf", "*.json"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, inputs)
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			doc, err := os.ReadFile(input)
+			assert.NoError(t, err)
+
+			actual, _, err := ADFToMD(string(doc), adfAttachments, userMap)
+			assert.NoError(t, err)
+
+			golden := strings.TrimSuffix(input, ".json") + ".md"
+			if *update {
+				assert.NoError(t, os.WriteFile(golden, []byte(actual+"\n"), 0o644))
+			}
+
+			expected, err := os.ReadFile(golden)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.TrimSuffix(string(expected), "\n"), actual)
+		})
+	}
+}
+
+func TestADFToMDUsedAttachments(t *testing.T) {
+	doc, err := os.ReadFile(filepath.Join("testdata", "adf", "media.json"))
+	assert.NoError(t, err)
+
+	_, used, err := ADFToMD(string(doc), adfAttachments, userMap)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SCR-20230906-oflk.png", "SCR-20230906-ofnz.png"}, used)
+
+	actual, used, err := ADFToMD("", adfAttachments, userMap)
+	assert.NoError(t, err)
+	assert.Equal(t, "", actual)
+	assert.Empty(t, used)
+}
+
+func TestADFMentions(t *testing.T) {
+	doc, err := os.ReadFile(filepath.Join("testdata", "adf", "macro.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jeff", "5b10ac8d82e05b22cc7d4ef5"}, adfMentions(string(doc)))
+}
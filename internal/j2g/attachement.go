@@ -12,43 +12,271 @@
 package j2g
 
 import (
-	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/cache"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/state"
 )
 
 type AttachmentMap map[string]*Attachment
 
 type Attachment struct {
+	ID        string //* Jira Attachment ID
 	Markdown  string
 	Filename  string
 	Alt       string
 	URL       string
 	CreatedAt string
+	Rejected  bool //* Not uploaded by the attachment policy, always written as Markdown
 }
 
-func convertJiraAttachmentToMarkdown(gl *gitlab.Client, jr *jira.Client, id interface{}, attachement *jira.Attachment) (*Attachment, error) {
-	res, err := jr.Issue.DownloadAttachment(context.Background(), attachement.ID)
+func convertJiraAttachmentToMarkdown(gl *gitlab.Client, src jirax.Source, store *state.Store, id interface{}, attachement *jira.Attachment) (*Attachment, error) {
+	attachment, _, err := uploadJiraAttachment(src, store, state.KindAttachment, state.KindUpload, id, attachement, func(reader io.Reader) (*gitlab.ProjectFile, *gitlab.Response, error) {
+		return gl.Projects.UploadFile(id, reader, attachement.Filename)
+	})
 	if err != nil {
-		return nil, errors.Wrap(err, "Error downloading file")
+		return nil, err
 	}
+	return attachment, nil
+}
+
+// uploadJiraAttachment uploads the attachment once per project or group.
+// The attachment is recorded with the kind, and its content with the content kind, so identical files are uploaded once and their Markdown reused.
+func uploadJiraAttachment(src jirax.Source, store *state.Store, kind state.Kind, contentKind state.Kind, id interface{}, attachement *jira.Attachment, upload func(io.Reader) (*gitlab.ProjectFile, *gitlab.Response, error)) (*Attachment, *gitlab.Response, error) {
+	parent := fmt.Sprint(id)
+	newAttachment := func(entry *state.Entry) *Attachment {
+		return &Attachment{
+			ID:        attachement.ID,
+			Markdown:  entry.Markdown,
+			Filename:  attachement.Filename,
+			CreatedAt: attachement.Created,
+			Alt:       entry.Alt,
+			URL:       entry.URL,
+		}
+	}
+
+	//* Reuse the attachment uploaded by a previous run
+	if entry, ok := store.Get(kind, attachement.ID); ok && entry.Parent == parent {
+		return newAttachment(entry), nil, nil
+	}
+
+	sum, err := getCachedJiraAttachment(src, attachement)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error downloading file")
+	}
+
+	//* The same content is uploaded once per project or group
+	contentKey := parent + "/" + sum
+	lock, _ := uploadLocks.LoadOrStore(contentKey, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	entry, ok := store.Get(contentKind, contentKey)
+	if ok {
+		log.Debugf("Reusing upload %s for attachment %s", entry.URL, attachement.Filename)
+	} else {
+		c, err := cache.GetCache()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "Error opening attachment cache")
+		}
+
+		var gitlabUploadedFile *gitlab.ProjectFile
+		resp, err := retry(func() (*gitlab.Response, error) {
+			file, err := c.Open(sum)
+			if err != nil {
+				return nil, err
+			}
+			defer file.Close()
+
+			var resp *gitlab.Response
+			gitlabUploadedFile, resp, err = upload(file)
+			return resp, err
+		})
+		if err != nil {
+			return nil, resp, errors.Wrap(err, "Error uploading file")
+		}
+
+		entry = &state.Entry{
+			Kind:     contentKind,
+			Key:      contentKey,
+			Parent:   parent,
+			Markdown: gitlabUploadedFile.Markdown,
+			Alt:      gitlabUploadedFile.Alt,
+			URL:      gitlabUploadedFile.URL,
+		}
+		if err := store.Put(entry); err != nil {
+			return nil, nil, errors.Wrap(err, "Error recording uploaded file")
+		}
+	}
+
+	err = store.Put(&state.Entry{
+		Kind:     kind,
+		Key:      attachement.ID,
+		Parent:   parent,
+		Markdown: entry.Markdown,
+		Alt:      entry.Alt,
+		URL:      entry.URL,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error recording uploaded file")
+	}
+
+	return newAttachment(entry), nil, nil
+}
+
+// getCachedJiraAttachment returns the SHA-256 of the attachment content, it is downloaded once into the cache.
+func getCachedJiraAttachment(src jirax.Source, attachement *jira.Attachment) (string, error) {
+	c, err := cache.GetCache()
+	if err != nil {
+		return "", errors.Wrap(err, "Error opening attachment cache")
+	}
+
+	if sum, ok := c.Lookup(src.Origin(), attachement.ID); ok {
+		return sum, nil
+	}
+
+	var sum string
+	_, err = retry(func() (*gitlab.Response, error) {
+		fileReader, err := src.DownloadAttachment(attachement)
+		if err != nil {
+			return nil, err
+		}
+		defer fileReader.Close()
+
+		sum, err = c.Add(src.Origin(), attachement.ID, fileReader)
+		return nil, err
+	})
+	if err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// retry calls the function again after a failure, unless GitLab answered with a client error.
+func retry(fn func() (*gitlab.Response, error)) (*gitlab.Response, error) {
+	var resp *gitlab.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		resp, err = fn()
+		if err == nil {
+			return resp, nil
+		}
+
+		retryable := resp == nil || resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests
+		if !retryable || attempt == retryAttempts {
+			return resp, err
+		}
+
+		log.Warnf("Retrying after attempt %d failed: %v", attempt, err)
+		time.Sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
+var (
+	//* Set once the group uploads API answered it does not exist
+	groupUploadsUnsupported atomic.Bool
+	//* Group or project -> web URL, the uploads are served under it
+	uploadBaseURLs sync.Map
+	//* Group or project / SHA-256 -> lock, identical files are uploaded once
+	uploadLocks sync.Map
+)
+
+const (
+	retryAttempts = 3
+	retryDelay    = 2 * time.Second
+)
 
-	fileReader := res.Body
-	defer fileReader.Close()
+// convertJiraAttachmentToEpicMarkdown uploads the attachment to the epic group, or to the attachments project when GitLab has no group uploads API.
+// Epics are rendered outside of the project, so the Markdown links to the absolute URL of the upload.
+func convertJiraAttachmentToEpicMarkdown(gl *gitlab.Client, src jirax.Source, store *state.Store, gid interface{}, pid interface{}, attachement *jira.Attachment) (*Attachment, error) {
+	attachment, err := uploadJiraAttachmentToGroup(gl, src, store, gid, attachement)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error uploading file to group")
+	}
+	base := gid
+
+	if attachment == nil {
+		attachment, err = convertJiraAttachmentToMarkdown(gl, src, store, pid, attachement)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error uploading file to project")
+		}
+		base = pid
+	}
 
-	// Upload image to GitLab and retreive a URL
-	gitlabUploadedFile, _, err := gl.Projects.UploadFile(id, fileReader, attachement.Filename, nil)
+	baseURL, err := getUploadBaseURL(gl, base, base == gid)
 	if err != nil {
-		return nil, errors.Wrap(err, "Error uploading file")
+		return nil, errors.Wrap(err, "Error getting upload URL")
 	}
 
-	return &Attachment{
-		Markdown:  gitlabUploadedFile.Markdown,
-		Filename:  attachement.Filename,
-		CreatedAt: attachement.Created,
-		Alt:       gitlabUploadedFile.Alt,
-		URL:       gitlabUploadedFile.URL,
-	}, nil
+	attachment.Markdown = absoluteUploadMarkdown(attachment.Markdown, attachment.URL, baseURL)
+	attachment.URL = baseURL + attachment.URL
+	return attachment, nil
+}
+
+// uploadJiraAttachmentToGroup returns nil without error when the group uploads API is not available.
+func uploadJiraAttachmentToGroup(gl *gitlab.Client, src jirax.Source, store *state.Store, gid interface{}, attachement *jira.Attachment) (*Attachment, error) {
+	if entry, ok := store.Get(state.KindGroupAttachment, attachement.ID); !ok || entry.Parent != fmt.Sprint(gid) {
+		if groupUploadsUnsupported.Load() {
+			return nil, nil
+		}
+	}
+
+	attachment, resp, err := uploadJiraAttachment(src, store, state.KindGroupAttachment, state.KindGroupUpload, gid, attachement, func(reader io.Reader) (*gitlab.ProjectFile, *gitlab.Response, error) {
+		return gitlabx.UploadGroupFile(gl, gid, reader, attachement.Filename)
+	})
+	if resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed) {
+		if groupUploadsUnsupported.CompareAndSwap(false, true) {
+			log.Info("GitLab has no group uploads API, the epic attachments are uploaded to the attachments project")
+		}
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+// getUploadBaseURL returns the URL the uploads of the group or project are served under.
+// It is read from GitLab instead of built from the configured path, so it follows the ID and moved namespaces.
+func getUploadBaseURL(gl *gitlab.Client, id interface{}, group bool) (string, error) {
+	key := fmt.Sprintf("%t/%v", group, id)
+	if baseURL, ok := uploadBaseURLs.Load(key); ok {
+		return baseURL.(string), nil
+	}
+
+	var baseURL string
+	if group {
+		gitlabGroup, _, err := gl.Groups.GetGroup(id, nil)
+		if err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("Error getting GitLab group: %v", id))
+		}
+		baseURL = strings.TrimSuffix(gitlabGroup.WebURL, "/") + "/-"
+	} else {
+		gitlabProject, _, err := gl.Projects.GetProject(id, nil)
+		if err != nil {
+			return "", errors.Wrap(err, fmt.Sprintf("Error getting GitLab project: %v", id))
+		}
+		baseURL = strings.TrimSuffix(gitlabProject.WebURL, "/")
+	}
+
+	uploadBaseURLs.Store(key, baseURL)
+	return baseURL, nil
+}
+
+// absoluteUploadMarkdown points the image or file link of the upload Markdown to the absolute URL.
+// ![alt](/uploads/:secret/:filename) and [filename](/uploads/:secret/:filename) are both rewritten.
+func absoluteUploadMarkdown(markdown string, url string, baseURL string) string {
+	return strings.ReplaceAll(markdown, "]("+url+")", "]("+baseURL+url+")")
 }
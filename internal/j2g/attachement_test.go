@@ -0,0 +1,36 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import "testing"
+
+func TestAbsoluteUploadMarkdown(t *testing.T) {
+	baseURL := "https://gitlab.example.com/groups/infograb/team/-"
+	url := "/uploads/66dbcd21ec5d24ed6ea225176098d52b/design.png"
+
+	tests := []struct {
+		name     string
+		markdown string
+		want     string
+	}{
+		{"image", "![design](" + url + ")", "![design](" + baseURL + url + ")"},
+		{"file", "[design.pdf](" + url + ")", "[design.pdf](" + baseURL + url + ")"},
+		{"other url", "[design.pdf](/uploads/other/design.pdf)", "[design.pdf](/uploads/other/design.pdf)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := absoluteUploadMarkdown(tt.markdown, url, baseURL); got != tt.want {
+				t.Errorf("absoluteUploadMarkdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
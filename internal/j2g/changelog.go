@@ -0,0 +1,99 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+)
+
+// The values of these fields are too long for a note
+var changelogTextFields = map[string]bool{
+	"description": true,
+	"environment": true,
+}
+
+// changeNote is a Jira changelog history replayed as a GitLab note
+type changeNote struct {
+	ID      string
+	Body    *string
+	Created *time.Time
+	Options []gitlab.RequestOptionFunc //* Sudo as the author in impersonate mode
+}
+
+// Changelog -> Comments
+// Each history of the changelog becomes a note, in the order of the changelog.
+func jiraChangeNotes(cfg *config.Config, userMap UserMap, jiraIssue *jira.Issue) ([]*changeNote, error) {
+	if jiraIssue.Changelog == nil {
+		return nil, nil
+	}
+
+	result := []*changeNote{}
+	for _, history := range jiraIssue.Changelog.Histories {
+		if len(history.Items) == 0 {
+			continue
+		}
+
+		options, impersonated := sudo(cfg, userMap, &history.Author)
+		body, created, err := formatChange(history, impersonated)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error formatting change %s", history.Id))
+		}
+
+		result = append(result, &changeNote{history.Id, body, created, options})
+	}
+
+	return result, nil
+}
+
+func formatChange(history jira.ChangelogHistory, impersonated bool) (*string, *time.Time, error) {
+	created, err := time.Parse("2006-01-02T15:04:05.000-0700", history.Created)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error parsing time")
+	}
+
+	dateFormat := fmt.Sprintf("%s at %s", created.Format("January 02, 2006"), created.Format("3:04 PM"))
+
+	var b strings.Builder
+	if impersonated {
+		fmt.Fprintf(&b, "Changed on %s\n", dateFormat)
+	} else {
+		fmt.Fprintf(&b, "Changed on %s by %s\n", dateFormat, history.Author.DisplayName)
+	}
+
+	for _, item := range history.Items {
+		if changelogTextFields[strings.ToLower(item.Field)] {
+			fmt.Fprintf(&b, "\n- **%s** changed", item.Field)
+			continue
+		}
+		fmt.Fprintf(&b, "\n- **%s**: %s → %s", item.Field, formatChangeValue(item.FromString), formatChangeValue(item.ToString))
+	}
+
+	fmt.Fprintf(&b, "\n\n%s", importedChangeMarker(history.Id))
+
+	result := b.String()
+	return &result, &created, nil
+}
+
+func formatChangeValue(value string) string {
+	if value == "" {
+		return "_None_"
+	}
+	value = strings.Join(strings.Fields(value), " ")
+	return fmt.Sprintf("`%s`", strings.ReplaceAll(value, "`", "'"))
+}
@@ -0,0 +1,50 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/stretchr/testify/assert"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestFormatChange(t *testing.T) {
+	history := jira.ChangelogHistory{
+		Id:      "10100",
+		Author:  jira.User{Name: "jeff", DisplayName: "Jeff"},
+		Created: "2023-09-06T09:00:00.000+0900",
+		Items: []jira.ChangelogItems{
+			{Field: "status", FromString: "To Do", ToString: "In Progress"},
+			{Field: "assignee", FromString: "", ToString: "Jeff"},
+			{Field: "description", FromString: "old", ToString: "new"},
+		},
+	}
+
+	body, created, err := formatChange(history, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Changed on September 06, 2023 at 9:00 AM by Jeff\n\n"+
+		"- **status**: `To Do` → `In Progress`\n"+
+		"- **assignee**: _None_ → `Jeff`\n"+
+		"- **description** changed\n\n"+
+		"<!-- Imported from Jira change 10100 -->", *body)
+	assert.Equal(t, 2023, created.Year())
+
+	body, _, err = formatChange(history, true)
+	assert.NoError(t, err)
+	assert.Contains(t, *body, "Changed on September 06, 2023 at 9:00 AM\n")
+
+	notes := indexImportedNotes([]*gitlab.Note{{ID: 1, Body: *body}})
+	note, ok := notes.change("10100")
+	assert.True(t, ok)
+	assert.Equal(t, 1, note.ID)
+}
@@ -13,7 +13,6 @@ package j2g
 
 import (
 	"fmt"
-	"regexp"
 	"sync"
 	"time"
 
@@ -23,11 +22,14 @@ import (
 	gitlab "github.com/xanzy/go-gitlab"
 	"gitlab.com/infograb-public/j2lab/internal/config"
 	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/state"
 	"gitlab.com/infograb-public/j2lab/internal/utils"
 	"golang.org/x/sync/errgroup"
 )
 
-func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, jr *jira.Client, jiraIssue *jira.Issue, userMap UserMap, existingLabels map[string]string) (*gitlab.Epic, error) {
+// If imported is not nil, the GitLab epic imported by a previous run is updated in place instead of creating a new one.
+func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, src jirax.Source, store *state.Store, jiraIssue *jira.Issue, imported *gitlab.Epic, userMap UserMap, existingLabels map[string]string) (*gitlab.Epic, error) {
 	log := logrus.WithField("jiraEpic", jiraIssue.Key)
 	var g errgroup.Group
 	g.SetLimit(5)
@@ -40,7 +42,7 @@ func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, jr *jira.Client, jiraIssue
 
 	gid := cfg.GitLab.Epic
 
-	labels, err := convertJiraToGitLabLabels(gl, gid, jiraIssue, existingLabels, true)
+	labels, err := convertJiraToGitLabLabels(gl, store, gid, jiraIssue, existingLabels, true)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error converting Jira labels to GitLab labels")
 	}
@@ -54,41 +56,24 @@ func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, jr *jira.Client, jiraIssue
 	}
 
 	//* Attachment for Description and Comments
-	//! Epic Attachment는 API가 없는 관계로 우회한다.
-	// 1. cfg.Project.GitLab.Issue 프로젝트에 attachement를 붙인다.
-	// 2. 결과 markdown을 절대 경로로 바꾼 후 epic description에 붙인다
-	pid := cfg.GitLab.Issue
+	//! Epic에는 attachment API가 없으므로 그룹에 업로드하고, 지원하지 않는 GitLab은 attachments 프로젝트에 업로드한다.
+	//! 결과 markdown은 절대 경로로 바꾼 후 epic description에 붙인다
+	pid := cfg.AttachmentProject()
 	usedAttachment := make(map[string]bool)
 
 	attachments := make(map[string]*Attachment) // Filename -> Markdown
 	for _, jiraAttachment := range jiraIssue.Fields.Attachments {
 		g.Go(func(jiraAttachment *jira.Attachment) func() error {
 			return func() error {
-				attachment, err := convertJiraAttachmentToMarkdown(gl, jr, pid, jiraAttachment)
+				attachment, err := convertJiraAttachmentWithPolicy(cfg, src, jiraIssue.Key, jiraAttachment, func() (*Attachment, error) {
+					return convertJiraAttachmentToEpicMarkdown(gl, src, store, gid, pid, jiraAttachment)
+				})
 				if err != nil {
-					return errors.Wrap(err, "Error converting Jira attachment to GitLab attachment")
-				}
-
-				regexp := regexp.MustCompile(`!\[(.+)\]\((.+)\)`)
-				matches := regexp.FindStringSubmatch(attachment.Markdown)
-
-				if len(matches) != 3 {
-					return errors.Wrap(err, "Error parsing markdown")
+					return errors.Wrap(err, fmt.Sprintf("Error converting Jira attachment %s to GitLab attachment", jiraAttachment.Filename))
 				}
 
-				alt := matches[1]
-				url := matches[2]
-
-				absUrl := fmt.Sprintf("%s/%s/%s", cfg.GitLab.Host, cfg.GitLab.Issue, url)
-
 				mutex.Lock()
-				attachments[jiraAttachment.Filename] = &Attachment{
-					Markdown:  fmt.Sprintf("![%s](%s)", alt, absUrl),
-					Filename:  attachment.Filename,
-					CreatedAt: attachment.CreatedAt,
-					Alt:       alt,
-					URL:       absUrl,
-				}
+				attachments[jiraAttachment.Filename] = attachment
 				mutex.Unlock()
 				log.Debugf("Converted attachment: %s to %s", jiraAttachment.Filename, attachment.Markdown)
 				return nil
@@ -133,18 +118,56 @@ func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, jr *jira.Client, jiraIssue
 		gitlabCreateEpicOptions.DueDateFixed = (*gitlab.ISOTime)(&jiraIssue.Fields.Duedate)
 	}
 
-	//* 에픽을 생성합니다.
-	gitlabEpic, _, err := gitlabx.CreateEpic(gl, cfg.GitLab.Epic, &gitlabCreateEpicOptions)
-	if err != nil {
-		return nil, errors.Wrap(err, "Error creating GitLab epic")
+	//* 에픽을 생성합니다. 이전에 가져온 에픽은 갱신합니다.
+	var gitlabEpic *gitlab.Epic
+	var notes *importedNotes
+	if imported == nil {
+		options, _ := sudo(cfg, userMap, jiraIssue.Fields.Reporter)
+		gitlabEpic, _, err = gitlabx.CreateEpic(gl, cfg.GitLab.Epic, &gitlabCreateEpicOptions, options...)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating GitLab epic")
+		}
+		log.Debugf("Created GitLab epic: %d from Jira issue: %s", gitlabEpic.IID, jiraIssue.Key)
+
+		//* Recorded as soon as it exists, a resumed run completes it
+		err = store.Put(&state.Entry{
+			Kind:    state.KindEpic,
+			Key:     jiraIssue.Key,
+			ID:      gitlabEpic.ID,
+			IID:     gitlabEpic.IID,
+			Parent:  gid,
+			Partial: true,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error recording epic: %s", jiraIssue.Key))
+		}
+	} else {
+		gitlabEpic, _, err = gl.Epics.UpdateEpic(gid, imported.IID, &gitlab.UpdateEpicOptions{
+			Title:            gitlabCreateEpicOptions.Title,
+			Description:      gitlabCreateEpicOptions.Description,
+			Labels:           gitlabCreateEpicOptions.Labels,
+			StartDateIsFixed: gitlabCreateEpicOptions.StartDateIsFixed,
+			StartDateFixed:   gitlabCreateEpicOptions.StartDateFixed,
+			DueDateIsFixed:   gitlabCreateEpicOptions.DueDateIsFixed,
+			DueDateFixed:     gitlabCreateEpicOptions.DueDateFixed,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error updating GitLab epic")
+		}
+		log.Debugf("Updated GitLab epic: %d from Jira issue: %s", gitlabEpic.IID, jiraIssue.Key)
+
+		notes, err = listImportedEpicNotes(gl, gid, gitlabEpic.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting GitLab notes")
+		}
 	}
-	log.Debugf("Created GitLab epic: %d from Jira issue: %s", gitlabEpic.IID, jiraIssue.Key)
 
 	//* Comment -> Comment
 	for _, jiraComment := range jiraIssue.Fields.Comments.Comments {
 		g.Go(func(jiraComment *jira.Comment) func() error {
 			return func() error {
-				body, _, usedImages, err := formatNote(jiraIssue.Key, jiraComment, userMap, attachments, true)
+				sudoOptions, impersonated := sudo(cfg, userMap, &jiraComment.Author)
+				body, _, usedImages, err := formatNote(jiraIssue.Key, jiraComment, userMap, attachments, true, impersonated)
 				if err != nil {
 					return errors.Wrap(err, "Error formatting comment")
 				}
@@ -155,11 +178,25 @@ func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, jr *jira.Client, jiraIssue
 					mutex.Unlock()
 				}
 
+				if importedNote, ok := notes.comment(jiraCommentLink(cfg, jiraIssue.Key, jiraComment.ID)); ok {
+					if trimmedEqual(importedNote.Body, *body) {
+						return nil
+					}
+
+					_, _, err = gl.Notes.UpdateEpicNote(gid, gitlabEpic.ID, importedNote.ID, &gitlab.UpdateEpicNoteOptions{
+						Body: body,
+					})
+					if err != nil {
+						return errors.Wrap(err, "Error updating note")
+					}
+					return nil
+				}
+
 				createEpicNoteOptions := gitlab.CreateEpicNoteOptions{
 					Body: body,
 				}
 
-				_, _, err = gl.Notes.CreateEpicNote(gid, gitlabEpic.ID, &createEpicNoteOptions)
+				_, _, err = gl.Notes.CreateEpicNote(gid, gitlabEpic.ID, &createEpicNoteOptions, sudoOptions...)
 				if err != nil {
 					return errors.Wrap(err, "Error creating note")
 				}
@@ -172,16 +209,39 @@ func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, jr *jira.Client, jiraIssue
 		return nil, errors.Wrap(err, fmt.Sprintf("Error creating GitLab comment with gid %s, epic ID %d", gid, gitlabEpic.ID))
 	}
 
+	//* Changelog -> Comment
+	changes, err := jiraChangeNotes(cfg, userMap, jiraIssue)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error formatting changelog")
+	}
+	for _, change := range changes {
+		if _, ok := notes.change(change.ID); ok {
+			continue
+		}
+
+		_, _, err = gl.Notes.CreateEpicNote(gid, gitlabEpic.ID, &gitlab.CreateEpicNoteOptions{
+			Body: change.Body,
+		}, change.Options...)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating changelog note")
+		}
+	}
+
 	//* Reamin Attachment -> Comment
 	for id, markdown := range attachments {
 		if used, ok := usedAttachment[id]; ok || used {
 			continue
 		}
 
+		if _, ok := notes.attachment(markdown.ID); ok {
+			continue
+		}
+
 		g.Go(func(markdown *Attachment) func() error {
 			return func() error {
-				_, _, err = gl.Notes.CreateEpicNote(gid, gitlabEpic.ID, &gitlab.CreateEpicNoteOptions{
-					Body: &markdown.Markdown,
+				body := fmt.Sprintf("%s\n\n%s", markdown.Markdown, importedAttachmentMarker(markdown.ID))
+				_, _, err := gl.Notes.CreateEpicNote(gid, gitlabEpic.ID, &gitlab.CreateEpicNoteOptions{
+					Body: &body,
 				})
 				if err != nil {
 					return errors.Wrap(err, "Error creating note")
@@ -195,12 +255,24 @@ func ConvertJiraIssueToGitLabEpic(gl *gitlab.Client, jr *jira.Client, jiraIssue
 		return nil, errors.Wrap(err, "Error creating GitLab issue")
 	}
 
-	//* Resolution -> Close issue (CloseAt)
-	if jiraIssue.Fields.Resolution != nil {
-		gl.Epics.UpdateEpic(gid, gitlabEpic.IID, &gitlab.UpdateEpicOptions{
+	//* Resolution or Status -> Close issue (CloseAt)
+	//* A failed close or reopen fails the run, so a sync retries it
+	if isJiraIssueClosed(cfg, jiraIssue) && gitlabEpic.State != "closed" {
+		_, _, err := gl.Epics.UpdateEpic(gid, gitlabEpic.IID, &gitlab.UpdateEpicOptions{
 			StateEvent: gitlab.String("close"),
 		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error closing GitLab epic: %s", jiraIssue.Key))
+		}
 		log.Debugf("Closed GitLab epic: %d", gitlabEpic.IID)
+	} else if !isJiraIssueClosed(cfg, jiraIssue) && gitlabEpic.State == "closed" {
+		_, _, err := gl.Epics.UpdateEpic(gid, gitlabEpic.IID, &gitlab.UpdateEpicOptions{
+			StateEvent: gitlab.String("reopen"),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error reopening GitLab epic: %s", jiraIssue.Key))
+		}
+		log.Debugf("Reopened GitLab epic: %d", gitlabEpic.IID)
 	}
 
 	return gitlabEpic, nil
@@ -0,0 +1,210 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	gosync "sync"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"golang.org/x/sync/errgroup"
+)
+
+// ! Entry
+// Export reads everything the run command reads from Jira into the archive directory.
+// Only Jira is called, the archive is migrated later from a machine that reaches GitLab.
+func Export(jr *jira.Client, dir string) (*jirax.Archive, error) {
+	var g errgroup.Group
+	g.SetLimit(5)
+	mutex := gosync.Mutex{}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting config")
+	}
+
+	src := jirax.NewClientSource(jr, cfg.IsJiraCloud())
+	archive := jirax.NewArchive(cfg.Jira.Host, cfg.Jira.Flavor)
+
+	//* Project and Versions
+	archive.Project, err = src.GetProject(cfg.Jira.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting Jira project")
+	}
+
+	statuses, err := jirax.GetProjectStatuses(jr, cfg.Jira.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting Jira statuses")
+	}
+	archive.Statuses = statuses
+
+	//* Issues with their changelog
+	archive.Epics, archive.Issues, err = src.GetIssues(cfg.Jira.Name, cfg.Jira.Jql, "changelog")
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting Jira issues: %s", cfg.Jira.Name))
+	}
+	jiraIssues := append(append([]*jira.Issue{}, archive.Epics...), archive.Issues...)
+	log.Infof("Exporting %d epics and %d issues", len(archive.Epics), len(archive.Issues))
+
+	//* Sprints
+	if cfg.Jira.Board != 0 {
+		archive.Sprints, err = src.GetSprints(cfg.Jira.Board)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting Jira sprints")
+		}
+	}
+
+	//* Complete worklogs, the search results only include the first ones
+	for _, jiraIssue := range jiraIssues {
+		g.Go(func(jiraIssue *jira.Issue) func() error {
+			return func() error {
+				worklogs, err := getJiraWorklogs(src, jiraIssue)
+				if err != nil {
+					return err
+				}
+				jiraIssue.Fields.Worklog = &jira.Worklog{
+					MaxResults: len(worklogs),
+					Total:      len(worklogs),
+					Worklogs:   worklogs,
+				}
+				return nil
+			}
+		}(jiraIssue))
+	}
+	if err := g.Wait(); err != nil {
+		return nil, errors.Wrap(err, "Error getting Jira worklogs")
+	}
+
+	//* Attachments
+	for _, jiraIssue := range jiraIssues {
+		for _, jiraAttachment := range jiraIssue.Fields.Attachments {
+			g.Go(func(jiraIssue *jira.Issue, jiraAttachment *jira.Attachment) func() error {
+				return func() error {
+					path := jirax.AttachmentPath(jiraAttachment)
+					if err := downloadJiraAttachment(src, jiraAttachment, filepath.Join(dir, filepath.FromSlash(path))); err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error downloading attachment %s of issue %s", jiraAttachment.Filename, jiraIssue.Key))
+					}
+
+					mutex.Lock()
+					archive.Attachments[jiraAttachment.ID] = path
+					mutex.Unlock()
+					return nil
+				}
+			}(jiraIssue, jiraAttachment))
+		}
+	}
+	if err := g.Wait(); err != nil {
+		return nil, errors.Wrap(err, "Error downloading Jira attachments")
+	}
+
+	//* Users
+	archive.Users, err = getJiraUsers(jr, cfg, jiraIssues)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting Jira users")
+	}
+
+	if err := archive.Write(dir); err != nil {
+		return nil, errors.Wrap(err, "Error writing archive")
+	}
+
+	return archive, nil
+}
+
+func downloadJiraAttachment(src jirax.Source, attachment *jira.Attachment, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Wrap(err, "Error creating directory")
+	}
+
+	reader, err := src.DownloadAttachment(attachment)
+	if err != nil {
+		return errors.Wrap(err, "Error downloading file")
+	}
+	defer reader.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "Error creating file")
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, reader); err != nil {
+		return errors.Wrap(err, "Error writing file")
+	}
+	return nil
+}
+
+// getJiraUsers returns the users of the issues.
+// The mentioned users are only known by their username or account ID and are read from Jira.
+func getJiraUsers(jr *jira.Client, cfg *config.Config, jiraIssues []*jira.Issue) ([]*jira.User, error) {
+	result := []*jira.User{}
+	exist := make(map[string]bool)
+	add := func(user *jira.User) {
+		if key := cfg.JiraUserKey(user); key != "" && !exist[key] {
+			exist[key] = true
+			result = append(result, user)
+		}
+	}
+
+	for _, jiraIssue := range jiraIssues {
+		add(jiraIssue.Fields.Assignee)
+		add(jiraIssue.Fields.Reporter)
+		add(jiraIssue.Fields.Creator)
+		if jiraIssue.Fields.Comments != nil {
+			for _, comment := range jiraIssue.Fields.Comments.Comments {
+				add(&comment.Author)
+			}
+		}
+		if jiraIssue.Fields.Worklog != nil {
+			for _, worklog := range jiraIssue.Fields.Worklog.Worklogs {
+				add(worklog.Author)
+			}
+		}
+		if jiraIssue.Changelog != nil {
+			for i := range jiraIssue.Changelog.Histories {
+				add(&jiraIssue.Changelog.Histories[i].Author)
+			}
+		}
+	}
+
+	mentioned, err := GetJiraUsernamesFromIssues(cfg, jiraIssues)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting mentioned Jira users")
+	}
+
+	for _, key := range mentioned {
+		if exist[key] {
+			continue
+		}
+
+		options := &jirax.UserQueryOptions{Username: key}
+		if cfg.IsJiraCloud() {
+			options = &jirax.UserQueryOptions{AccountId: key}
+		}
+
+		user, _, err := jirax.GetUser(jr, options)
+		if err != nil {
+			//* Mentions of deleted users are kept as they are
+			log.Warnf("Skipping mentioned Jira user %s: %v", key, err)
+			continue
+		}
+		add(user)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,204 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+)
+
+// Items imported by a previous run are found from the markers j2lab writes:
+// - Description: "Imported from Jira [KEY](...)" footer written by formatDescription
+// - Comment: "[[Original](.../browse/KEY?focusedCommentId=ID)]" written by formatNote
+// - Remaining attachment: hidden "<!-- Imported from Jira attachment ID -->" comment
+// - Attachment not uploaded by the attachment policy: hidden "<!-- Imported from Jira rejected attachment ID -->" comment
+// - Change history: hidden "<!-- Imported from Jira change ID -->" comment
+
+const importedFooter = "Imported from Jira"
+
+var (
+	importedFooterRegex     = regexp.MustCompile(`(?m)^` + importedFooter + ` \[([^\]]+)\]\([^)]*\)\s*$`)
+	importedNoteRegex       = regexp.MustCompile(`\[\[Original\]\(([^)]+)\)\]\s*$`)
+	importedAttachmentRegex = regexp.MustCompile(`<!-- ` + importedFooter + ` attachment (\S+) -->`)
+	importedRejectedRegex   = regexp.MustCompile(`<!-- ` + importedFooter + ` rejected attachment (\S+) -->`)
+	importedChangeRegex     = regexp.MustCompile(`<!-- ` + importedFooter + ` change (\S+) -->`)
+)
+
+// importedJiraKey returns the Jira key of the description written by formatDescription
+func importedJiraKey(description string) (string, bool) {
+	matches := importedFooterRegex.FindAllStringSubmatch(description, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	return matches[len(matches)-1][1], true
+}
+
+// isImportedNote returns whether the note was written by j2lab, from a comment, an attachment or a change
+func isImportedNote(body string) bool {
+	return importedNoteRegex.MatchString(body) || importedAttachmentRegex.MatchString(body) || importedRejectedRegex.MatchString(body) || importedChangeRegex.MatchString(body)
+}
+
+func importedAttachmentMarker(attachmentID string) string {
+	return fmt.Sprintf("<!-- %s attachment %s -->", importedFooter, attachmentID)
+}
+
+func importedRejectedAttachmentMarker(attachmentID string) string {
+	return fmt.Sprintf("<!-- %s rejected attachment %s -->", importedFooter, attachmentID)
+}
+
+func importedChangeMarker(historyID string) string {
+	return fmt.Sprintf("<!-- %s change %s -->", importedFooter, historyID)
+}
+
+// Jira Issue Key -> GitLab Issue imported by a previous run
+func findImportedIssues(gl *gitlab.Client, pid interface{}) (map[string]*gitlab.Issue, error) {
+	issues, err := gitlabx.Unpaginate[gitlab.Issue](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Issue, *gitlab.Response, error) {
+		return gl.Issues.ListProjectIssues(pid, &gitlab.ListProjectIssuesOptions{
+			ListOptions: *opt,
+			Search:      gitlab.String(importedFooter),
+			In:          gitlab.String("description"),
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error listing GitLab issues of %v", pid))
+	}
+
+	result := make(map[string]*gitlab.Issue)
+	for _, issue := range issues {
+		if key, ok := importedJiraKey(issue.Description); ok {
+			if _, ok := result[key]; ok {
+				log.Warnf("Jira issue %s is imported more than once, using GitLab issue #%d", key, result[key].IID)
+				continue
+			}
+			result[key] = issue
+		}
+	}
+
+	return result, nil
+}
+
+// Jira Issue Key -> GitLab Epic imported by a previous run
+// The epics of the subgroups are not listed, their IIDs are not the IIDs of the group epics.
+func findImportedEpics(gl *gitlab.Client, gid interface{}) (map[string]*gitlab.Epic, error) {
+	epics, err := gitlabx.Unpaginate[gitlab.Epic](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Epic, *gitlab.Response, error) {
+		return gl.Epics.ListGroupEpics(gid, &gitlab.ListGroupEpicsOptions{
+			ListOptions:             *opt,
+			Search:                  gitlab.String(importedFooter),
+			IncludeDescendantGroups: gitlab.Bool(false),
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error listing GitLab epics of %v", gid))
+	}
+
+	result := make(map[string]*gitlab.Epic)
+	for _, epic := range epics {
+		if key, ok := importedJiraKey(epic.Description); ok {
+			if _, ok := result[key]; ok {
+				log.Warnf("Jira issue %s is imported more than once, using GitLab epic &%d", key, result[key].IID)
+				continue
+			}
+			result[key] = epic
+		}
+	}
+
+	return result, nil
+}
+
+type importedNotes struct {
+	comments    map[string]*gitlab.Note // Jira comment link -> Note
+	attachments map[string]*gitlab.Note // Jira attachment ID -> Note
+	changes     map[string]*gitlab.Note // Jira changelog history ID -> Note
+}
+
+func indexImportedNotes(notes []*gitlab.Note) *importedNotes {
+	result := &importedNotes{
+		comments:    make(map[string]*gitlab.Note),
+		attachments: make(map[string]*gitlab.Note),
+		changes:     make(map[string]*gitlab.Note),
+	}
+
+	for _, note := range notes {
+		if note.System {
+			continue
+		}
+
+		if matches := importedNoteRegex.FindStringSubmatch(note.Body); len(matches) == 2 {
+			result.comments[matches[1]] = note
+		}
+
+		for _, matches := range importedAttachmentRegex.FindAllStringSubmatch(note.Body, -1) {
+			result.attachments[matches[1]] = note
+		}
+
+		if matches := importedChangeRegex.FindStringSubmatch(note.Body); len(matches) == 2 {
+			result.changes[matches[1]] = note
+		}
+	}
+
+	return result
+}
+
+func (n *importedNotes) comment(link string) (*gitlab.Note, bool) {
+	if n == nil {
+		return nil, false
+	}
+	note, ok := n.comments[link]
+	return note, ok
+}
+
+func (n *importedNotes) attachment(id string) (*gitlab.Note, bool) {
+	if n == nil {
+		return nil, false
+	}
+	note, ok := n.attachments[id]
+	return note, ok
+}
+
+func (n *importedNotes) change(id string) (*gitlab.Note, bool) {
+	if n == nil {
+		return nil, false
+	}
+	note, ok := n.changes[id]
+	return note, ok
+}
+
+func listImportedIssueNotes(gl *gitlab.Client, pid interface{}, iid int) (*importedNotes, error) {
+	notes, err := gitlabx.Unpaginate[gitlab.Note](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+		return gl.Notes.ListIssueNotes(pid, iid, &gitlab.ListIssueNotesOptions{ListOptions: *opt})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error listing notes of GitLab issue #%d", iid))
+	}
+	return indexImportedNotes(notes), nil
+}
+
+func listImportedEpicNotes(gl *gitlab.Client, gid interface{}, epicID int) (*importedNotes, error) {
+	notes, err := gitlabx.Unpaginate[gitlab.Note](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+		return gl.Notes.ListEpicNotes(gid, epicID, &gitlab.ListEpicNotesOptions{ListOptions: *opt})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error listing notes of GitLab epic %d", epicID))
+	}
+	return indexImportedNotes(notes), nil
+}
+
+// trimmedEqual compares the note bodies ignoring the surrounding whitespace GitLab may strip
+func trimmedEqual(a, b string) bool {
+	return strings.TrimSpace(a) == strings.TrimSpace(b)
+}
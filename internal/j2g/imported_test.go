@@ -0,0 +1,95 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestImportedJiraKey(t *testing.T) {
+	key, ok := importedJiraKey("Hello\n\nImported from Jira [SSP-25](https://jira.infograb.net/browse/SSP-25)")
+	assert.True(t, ok)
+	assert.Equal(t, "SSP-25", key)
+
+	key, ok = importedJiraKey("Imported from Jira [SSP-1](https://jira.infograb.net/browse/SSP-1) and edited\n\nImported from Jira [SSP-2](https://jira.infograb.net/browse/SSP-2)\n")
+	assert.True(t, ok)
+	assert.Equal(t, "SSP-2", key)
+
+	_, ok = importedJiraKey("Created in GitLab")
+	assert.False(t, ok)
+}
+
+func TestIsImportedNote(t *testing.T) {
+	assert.True(t, isImportedNote("Hello\n\nSeptember 06, 2023 at 9:00 AM by Jeff [[Original](https://jira.infograb.net/browse/SSP-25?focusedCommentId=10100)]"))
+	assert.True(t, isImportedNote("![a.png](/uploads/secret/a.png)\n\n<!-- Imported from Jira attachment 10000 -->"))
+	assert.True(t, isImportedNote("changed the status\n\n<!-- Imported from Jira change 10200 -->"))
+	assert.False(t, isImportedNote("Fixed in SSP-26"))
+}
+
+func TestIndexImportedNotes(t *testing.T) {
+	notes := indexImportedNotes([]*gitlab.Note{
+		{ID: 1, Body: "Hello\n\nSeptember 06, 2023 at 9:00 AM by Jeff [[Original](https://jira.infograb.net/browse/SSP-25?focusedCommentId=10100)]"},
+		{ID: 2, Body: "![a.png](/uploads/secret/a.png)\n\n<!-- Imported from Jira attachment 10000 -->"},
+		{ID: 3, Body: "changed the description", System: true},
+	})
+
+	note, ok := notes.comment("https://jira.infograb.net/browse/SSP-25?focusedCommentId=10100")
+	assert.True(t, ok)
+	assert.Equal(t, 1, note.ID)
+
+	note, ok = notes.attachment("10000")
+	assert.True(t, ok)
+	assert.Equal(t, 2, note.ID)
+
+	var empty *importedNotes
+	_, ok = empty.comment("https://jira.infograb.net/browse/SSP-25?focusedCommentId=10100")
+	assert.False(t, ok)
+}
+
+// newTestGitLab returns a GitLab client of the handler
+func newTestGitLab(t *testing.T, handler http.HandlerFunc) *gitlab.Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	gl, err := gitlab.NewClient("token", gitlab.WithBaseURL(server.URL))
+	require.NoError(t, err)
+	return gl
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	require.NoError(t, json.NewEncoder(w).Encode(v))
+}
+
+func TestFindImportedEpics(t *testing.T) {
+	gl := newTestGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		epics := []*gitlab.Epic{
+			{ID: 101, IID: 1, GroupID: 10, Description: "Imported from Jira [SSP-1](https://jira.infograb.net/browse/SSP-1)"},
+		}
+		//* The epics of the subgroups have their own IIDs
+		if r.URL.Query().Get("include_descendant_groups") != "false" {
+			epics = append(epics, &gitlab.Epic{ID: 201, IID: 2, GroupID: 20, Description: "Imported from Jira [SSP-2](https://jira.infograb.net/browse/SSP-2)"})
+		}
+		writeJSON(t, w, epics)
+	})
+
+	epics, err := findImportedEpics(gl, "infograb/poc")
+	require.NoError(t, err)
+	assert.Len(t, epics, 1)
+	assert.Equal(t, 1, epics["SSP-1"].IID)
+}
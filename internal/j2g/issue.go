@@ -22,10 +22,13 @@ import (
 	gitlab "github.com/xanzy/go-gitlab"
 	"gitlab.com/infograb-public/j2lab/internal/config"
 	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/state"
 	"golang.org/x/sync/errgroup"
 )
 
-func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue *jira.Issue, userMap UserMap, existingLabels map[string]string, existingMilestone map[string]*Milestone) (*gitlab.Issue, error) {
+// If imported is not nil, the GitLab issue imported by a previous run is updated in place instead of creating a new one.
+func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, src jirax.Source, store *state.Store, jiraIssue *jira.Issue, imported *gitlab.Issue, userMap UserMap, existingLabels map[string]string, existingMilestone map[string]*Milestone, existingIterations map[int]*Iteration) (*gitlab.Issue, error) {
 	log := logrus.WithField("jiraIssue", jiraIssue.Key)
 	var g errgroup.Group
 	g.SetLimit(5)
@@ -38,7 +41,7 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 
 	pid := cfg.GitLab.Issue
 
-	labels, err := convertJiraToGitLabLabels(gl, pid, jiraIssue, existingLabels, false)
+	labels, err := convertJiraToGitLabLabels(gl, store, pid, jiraIssue, existingLabels, false)
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("Error converting Jira labels to GitLab labels: issue %s", jiraIssue.Key))
 	}
@@ -57,7 +60,9 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 	for _, jiraAttachment := range jiraIssue.Fields.Attachments {
 		g.Go(func(jiraAttachment *jira.Attachment) func() error {
 			return func() error {
-				attachment, err := convertJiraAttachmentToMarkdown(gl, jr, pid, jiraAttachment)
+				attachment, err := convertJiraAttachmentWithPolicy(cfg, src, jiraIssue.Key, jiraAttachment, func() (*Attachment, error) {
+					return convertJiraAttachmentToMarkdown(gl, src, store, pid, jiraAttachment)
+				})
 				if err != nil {
 					return errors.Wrap(err, fmt.Sprintf("Error converting Jira attachment to GitLab Markdown: %s on issue %s", jiraAttachment.Filename, jiraIssue.Key))
 				}
@@ -88,7 +93,7 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 
 	//* Assignee
 	if jiraIssue.Fields.Assignee != nil {
-		if assignee, ok := userMap[jiraIssue.Fields.Assignee.Name]; ok {
+		if assignee, ok := userMap[cfg.JiraUserKey(jiraIssue.Fields.Assignee)]; ok {
 			gitlabCreateIssueOptions.AssigneeIDs = &[]int{assignee.ID}
 			gitlabCreateIssueOptions.AssigneeID = &assignee.ID
 		}
@@ -104,6 +109,11 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 		gitlabCreateIssueOptions.MilestoneID = &milestone.ID
 	}
 
+	//* Issue Type -> Issue Type
+	if mapping, ok := cfg.GetIssueTypeMapping(jiraIssue.Fields.Type.Name); ok && mapping.Type != "" {
+		gitlabCreateIssueOptions.IssueType = gitlab.String(mapping.Type)
+	}
+
 	//* Storypoint -> Weight (if custom field is provided)
 	if cfg.Jira.CustomField.StoryPoint != "" {
 		storyPoint, ok := jiraIssue.Fields.Unknowns[cfg.Jira.CustomField.StoryPoint].(float64)
@@ -115,18 +125,48 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 		}
 	}
 
-	//* 이슈를 생성합니다.
-	gitlabIssue, _, err := gitlabx.CreateIssue(gl, pid, gitlabCreateIssueOptions)
-	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("Error creating GitLab issue: issue %s", jiraIssue.Key))
+	//* 이슈를 생성합니다. 이전에 가져온 이슈는 갱신합니다.
+	var gitlabIssue *gitlab.Issue
+	var notes *importedNotes
+	if imported == nil {
+		options, _ := sudo(cfg, userMap, jiraIssue.Fields.Reporter)
+		gitlabIssue, _, err = gitlabx.CreateIssue(gl, pid, gitlabCreateIssueOptions, options...)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error creating GitLab issue: issue %s", jiraIssue.Key))
+		}
+		log.Debugf("Created GitLab issue: %d from Jira issue: %s", gitlabIssue.IID, jiraIssue.Key)
+
+		//* Recorded as soon as it exists, a resumed run completes it
+		err = store.Put(&state.Entry{
+			Kind:    state.KindIssue,
+			Key:     jiraIssue.Key,
+			ID:      gitlabIssue.ID,
+			IID:     gitlabIssue.IID,
+			Parent:  pid,
+			Partial: true,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error recording issue: %s", jiraIssue.Key))
+		}
+	} else {
+		gitlabIssue, _, err = gl.Issues.UpdateIssue(pid, imported.IID, updateIssueOptions(gitlabCreateIssueOptions))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error updating GitLab issue: issue %s", jiraIssue.Key))
+		}
+		log.Debugf("Updated GitLab issue: %d from Jira issue: %s", gitlabIssue.IID, jiraIssue.Key)
+
+		notes, err = listImportedIssueNotes(gl, pid, gitlabIssue.IID)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error getting GitLab notes: issue %s", jiraIssue.Key))
+		}
 	}
-	log.Debugf("Created GitLab issue: %d from Jira issue: %s", gitlabIssue.IID, jiraIssue.Key)
 
 	//* Comment -> Comment
 	for _, jiraComment := range jiraIssue.Fields.Comments.Comments {
 		g.Go(func(jiraComment *jira.Comment) func() error {
 			return func() error {
-				note, created, usedImages, err := formatNote(jiraIssue.Key, jiraComment, userMap, attachments, true)
+				sudoOptions, impersonated := sudo(cfg, userMap, &jiraComment.Author)
+				note, created, usedImages, err := formatNote(jiraIssue.Key, jiraComment, userMap, attachments, true, impersonated)
 				if err != nil {
 					return errors.Wrap(err, fmt.Sprintf("Error formatting note: issue %s", jiraIssue.Key))
 				}
@@ -137,12 +177,26 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 					mutex.Unlock()
 				}
 
+				if importedNote, ok := notes.comment(jiraCommentLink(cfg, jiraIssue.Key, jiraComment.ID)); ok {
+					if trimmedEqual(importedNote.Body, *note) {
+						return nil
+					}
+
+					_, _, err = gl.Notes.UpdateIssueNote(pid, gitlabIssue.IID, importedNote.ID, &gitlab.UpdateIssueNoteOptions{
+						Body: note,
+					})
+					if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error updating note: issue %s", jiraIssue.Key))
+					}
+					return nil
+				}
+
 				options := gitlab.CreateIssueNoteOptions{
 					Body:      note,
 					CreatedAt: created,
 				}
 
-				_, _, err = gl.Notes.CreateIssueNote(pid, gitlabIssue.IID, &options)
+				_, _, err = gl.Notes.CreateIssueNote(pid, gitlabIssue.IID, &options, sudoOptions...)
 				if err != nil {
 					return errors.Wrap(err, fmt.Sprintf("Error creating note: issue %s", jiraIssue.Key))
 				}
@@ -155,12 +209,35 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 		return nil, errors.Wrap(err, fmt.Sprintf("Error creating GitLab issue: issue %s", jiraIssue.Key))
 	}
 
+	//* Changelog -> Comment
+	changes, err := jiraChangeNotes(cfg, userMap, jiraIssue)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error formatting changelog: issue %s", jiraIssue.Key))
+	}
+	for _, change := range changes {
+		if _, ok := notes.change(change.ID); ok {
+			continue
+		}
+
+		_, _, err = gl.Notes.CreateIssueNote(pid, gitlabIssue.IID, &gitlab.CreateIssueNoteOptions{
+			Body:      change.Body,
+			CreatedAt: change.Created,
+		}, change.Options...)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error creating changelog note: issue %s", jiraIssue.Key))
+		}
+	}
+
 	//* Reamin Attachment -> Comment
 	for id, markdown := range attachments {
 		if used, ok := usedAttachment[id]; ok || used {
 			continue
 		}
 
+		if _, ok := notes.attachment(markdown.ID); ok {
+			continue
+		}
+
 		createdAt, err := time.Parse("2006-01-02T15:04:05.000-0700", markdown.CreatedAt)
 		if err != nil {
 			return nil, errors.Wrap(err, fmt.Sprintf("Error parsing time: issue %s", jiraIssue.Key))
@@ -168,8 +245,9 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 
 		g.Go(func(attachment *Attachment) func() error {
 			return func() error {
-				_, _, err = gl.Notes.CreateIssueNote(pid, gitlabIssue.IID, &gitlab.CreateIssueNoteOptions{
-					Body:      &attachment.Markdown,
+				body := fmt.Sprintf("%s\n\n%s", attachment.Markdown, importedAttachmentMarker(attachment.ID))
+				_, _, err := gl.Notes.CreateIssueNote(pid, gitlabIssue.IID, &gitlab.CreateIssueNoteOptions{
+					Body:      &body,
 					CreatedAt: &createdAt,
 				})
 				if err != nil {
@@ -184,14 +262,80 @@ func ConvertJiraIssueToGitLabIssue(gl *gitlab.Client, jr *jira.Client, jiraIssue
 		return nil, errors.Wrap(err, fmt.Sprintf("Error creating GitLab issue: issue %s", jiraIssue.Key))
 	}
 
-	//* Resolution -> Close issue (CloseAt)
-	if jiraIssue.Fields.Resolution != nil {
-		gl.Issues.UpdateIssue(pid, gitlabIssue.IID, &gitlab.UpdateIssueOptions{
+	//* Time Tracking -> Time Estimate and Spent Time
+	if err := convertJiraTimeEstimate(gl, pid, jiraIssue, gitlabIssue); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error converting time estimate: issue %s", jiraIssue.Key))
+	}
+
+	if err := convertJiraWorklogs(gl, src, pid, jiraIssue, gitlabIssue, userMap, imported != nil); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error converting worklogs: issue %s", jiraIssue.Key))
+	}
+
+	//* Last Sprint -> Iteration
+	sprints, err := jiraIssueSprints(cfg, jiraIssue)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error parsing sprints: issue %s", jiraIssue.Key))
+	}
+	if len(sprints) > 0 {
+		sprint := sprints[len(sprints)-1]
+		if iteration, ok := existingIterations[sprint.ID]; ok {
+			if gitlabIssue.Iteration == nil || gitlabIssue.Iteration.ID != iteration.ID {
+				_, err := gitlabx.SetIssueIteration(gl, pid, gitlabIssue.IID, iteration.ID)
+				if err != nil {
+					return nil, errors.Wrap(err, fmt.Sprintf("Error setting GitLab iteration: issue %s", jiraIssue.Key))
+				}
+			}
+		} else {
+			log.Warnf("No iteration for sprint %s on issue %s", sprint.Name, jiraIssue.Key)
+		}
+	}
+
+	//* Resolution or Status -> Close issue (CloseAt)
+	//* A failed close or reopen fails the run, so a sync retries it
+	if isJiraIssueClosed(cfg, jiraIssue) && gitlabIssue.State != "closed" {
+		_, _, err := gl.Issues.UpdateIssue(pid, gitlabIssue.IID, &gitlab.UpdateIssueOptions{
 			StateEvent: gitlab.String("close"),
 			UpdatedAt:  (*time.Time)(&jiraIssue.Fields.Resolutiondate), // 적용안됨
 		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error closing GitLab issue: issue %s", jiraIssue.Key))
+		}
 		log.Debugf("Closed GitLab issue: %d", gitlabIssue.IID)
+	} else if !isJiraIssueClosed(cfg, jiraIssue) && gitlabIssue.State == "closed" {
+		_, _, err := gl.Issues.UpdateIssue(pid, gitlabIssue.IID, &gitlab.UpdateIssueOptions{
+			StateEvent: gitlab.String("reopen"),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error reopening GitLab issue: issue %s", jiraIssue.Key))
+		}
+		log.Debugf("Reopened GitLab issue: %d", gitlabIssue.IID)
 	}
 
 	return gitlabIssue, nil
 }
+
+// updateIssueOptions converts the create options to update options.
+// The assignees and the milestone are cleared if they are no longer set in Jira.
+func updateIssueOptions(opt *gitlabx.CreateIssueOptions) *gitlab.UpdateIssueOptions {
+	result := &gitlab.UpdateIssueOptions{
+		Title:        opt.Title,
+		Description:  opt.Description,
+		Confidential: opt.Confidential,
+		AssigneeIDs:  opt.AssigneeIDs,
+		MilestoneID:  opt.MilestoneID,
+		Labels:       opt.Labels,
+		DueDate:      opt.DueDate,
+		EpicID:       opt.EpicID,
+		Weight:       opt.Weight,
+		IssueType:    opt.IssueType,
+	}
+
+	if result.AssigneeIDs == nil {
+		result.AssigneeIDs = &[]int{}
+	}
+	if result.MilestoneID == nil {
+		result.MilestoneID = gitlab.Int(0)
+	}
+
+	return result
+}
@@ -0,0 +1,178 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/state"
+)
+
+type Iteration struct {
+	*gitlab.GroupIteration
+	JiraSprint *jira.Sprint
+}
+
+// jiraIssueSprints returns the sprints of the issue in the order of the sprint custom field
+func jiraIssueSprints(cfg *config.Config, jiraIssue *jira.Issue) ([]*jira.Sprint, error) {
+	if cfg.Jira.CustomField.Sprint == "" {
+		return nil, nil
+	}
+	return jirax.ParseSprints(jiraIssue.Fields.Unknowns[cfg.Jira.CustomField.Sprint])
+}
+
+// Every sprint of a Jira board goes to the iteration cadence of the board
+func iterationCadenceTitle(boardID int) string {
+	if boardID == 0 {
+		return "Jira sprints"
+	}
+	return fmt.Sprintf("Jira board %d", boardID)
+}
+
+func createIterationFromJiraSprint(gl *gitlab.Client, gid string, cadenceID string, jiraSprint *jira.Sprint) (*Iteration, error) {
+	log.Infof("Creating iteration: %s", jiraSprint.Name)
+
+	iteration, _, err := gitlabx.CreateIteration(gl, gid, &gitlabx.CreateIterationOptions{
+		CadenceID: cadenceID,
+		Title:     jiraSprint.Name,
+		StartDate: *jiraSprint.StartDate,
+		DueDate:   *jiraSprint.EndDate,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating iteration")
+	}
+
+	return &Iteration{
+		GroupIteration: iteration,
+		JiraSprint:     jiraSprint,
+	}, nil
+}
+
+// Jira Sprint ID -> GitLab Iteration
+// The sprints are read from the issues and from the Agile board if configured.
+// Sprints without dates can not be iterations and are skipped.
+func getIterations(gl *gitlab.Client, src jirax.Source, store *state.Store, jiraIssues []*jira.Issue) (map[int]*Iteration, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting config")
+	}
+
+	iterations := make(map[int]*Iteration)
+	if cfg.Jira.CustomField.Sprint == "" {
+		return iterations, nil
+	}
+
+	sprints := make(map[int]*jira.Sprint)
+	if cfg.Jira.Board != 0 {
+		boardSprints, err := src.GetSprints(cfg.Jira.Board)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting Jira sprints")
+		}
+		for _, sprint := range boardSprints {
+			sprints[sprint.ID] = sprint
+		}
+	}
+	for _, jiraIssue := range jiraIssues {
+		issueSprints, err := jiraIssueSprints(cfg, jiraIssue)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error parsing sprints of issue %s", jiraIssue.Key))
+		}
+		for _, sprint := range issueSprints {
+			if _, ok := sprints[sprint.ID]; !ok {
+				sprints[sprint.ID] = sprint
+			}
+		}
+	}
+
+	//* Sensitive to the title
+	existingIterations, err := gitlabx.Unpaginate[gitlab.GroupIteration](gl, func(opt *gitlab.ListOptions) ([]*gitlab.GroupIteration, *gitlab.Response, error) {
+		return gl.GroupIterations.ListGroupIterations(cfg.GitLab.Epic, &gitlab.ListGroupIterationsOptions{
+			ListOptions:      *opt,
+			IncludeAncestors: gitlab.Bool(true),
+		})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting GitLab iterations")
+	}
+
+	//* Iterations of a cadence must not overlap, so they are created in order of start date
+	ordered := []*jira.Sprint{}
+	for _, sprint := range sprints {
+		ordered = append(ordered, sprint)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].StartDate == nil || ordered[j].StartDate == nil {
+			return ordered[i].StartDate != nil
+		}
+		return ordered[i].StartDate.Before(*ordered[j].StartDate)
+	})
+
+	cadences := make(map[int]string)
+	for _, sprint := range ordered {
+		exist := false
+		for _, gitlabIteration := range existingIterations {
+			if gitlabIteration.Title == sprint.Name {
+				log.Infof("Iteration already exists: %s", sprint.Name)
+				iterations[sprint.ID] = &Iteration{gitlabIteration, sprint}
+				exist = true
+				break
+			}
+		}
+		if exist {
+			continue
+		}
+
+		if sprint.StartDate == nil || sprint.EndDate == nil {
+			log.Warnf("Skipping sprint without dates: %s", sprint.Name)
+			continue
+		}
+
+		cadenceID, ok := cadences[sprint.OriginBoardID]
+		if !ok {
+			cadenceID, err = gitlabx.GetOrCreateIterationCadence(gl, cfg.GitLab.Epic, iterationCadenceTitle(sprint.OriginBoardID))
+			if err != nil {
+				return nil, errors.Wrap(err, "Error getting GitLab iteration cadence")
+			}
+			cadences[sprint.OriginBoardID] = cadenceID
+		}
+
+		iteration, err := createIterationFromJiraSprint(gl, cfg.GitLab.Epic, cadenceID, sprint)
+		if err != nil {
+			//* e.g. the dates overlap with another iteration of the cadence
+			log.Warnf("Unable to create iteration %s: %v", sprint.Name, err)
+			continue
+		}
+		iterations[sprint.ID] = iteration
+
+		err = store.Put(&state.Entry{
+			Kind:   state.KindIteration,
+			Key:    strconv.Itoa(sprint.ID),
+			ID:     iteration.ID,
+			IID:    iteration.IID,
+			Parent: cfg.GitLab.Epic,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Error recording GitLab iteration")
+		}
+	}
+
+	return iterations, nil
+}
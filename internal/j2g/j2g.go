@@ -14,7 +14,8 @@ package j2g
 import (
 	"context"
 	"fmt"
-	"sync"
+	gosync "sync"
+	"time"
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	"github.com/pkg/errors"
@@ -23,40 +24,70 @@ import (
 	"gitlab.com/infograb-public/j2lab/internal/config"
 	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
 	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/state"
 	"golang.org/x/sync/errgroup"
 )
 
-func GetJiraIssues(jr *jira.Client, jiraProjectID string, jql string) ([]*jira.Issue, []*jira.Issue, error) {
-	//* JQL
-	var prefixJql string
-	if jql != "" {
-		prefixJql = fmt.Sprintf("(%s) AND", jql)
-	} else {
-		prefixJql = ""
+func GetJiraIssues(jr *jira.Client, cfg *config.Config, jql string, expand ...string) ([]*jira.Issue, []*jira.Issue, error) {
+	return jirax.NewClientSource(jr, cfg.IsJiraCloud()).GetIssues(cfg.Jira.Name, jql, expand...)
+}
+
+// ! Entry
+// Every created epic, issue, milestone, label and attachment is recorded in the store.
+// If the store is resumed, the epics and issues recorded by a previous run are skipped.
+// The Jira project is read from the source, the Jira site or an exported archive.
+func ConvertByProject(gl *gitlab.Client, src jirax.Source, store *state.Store) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
 	}
 
-	//* Get Jira Issues for Epic
-	epicJql := fmt.Sprintf("%s project = %s AND type = Epic Order by key ASC", prefixJql, jiraProjectID)
-	jiraEpics, err := jirax.UnpaginateIssue(jr, epicJql)
+	return convertByProject(gl, src, store, cfg.Jira.Jql, false)
+}
+
+// ! Entry
+// Only the Jira issues updated since the last successful run or sync are converted.
+// The epics and issues recorded in the store or imported by a previous run are updated in place.
+func SyncByProject(gl *gitlab.Client, jr *jira.Client, store *state.Store) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	watermark, ok := store.Get(state.KindSync, cfg.Jira.Name)
+	if !ok {
+		return errors.Errorf("No successful run found for Jira project %s, use the run command first", cfg.Jira.Name)
+	}
+
+	//* JQL dates are in the time zone of the Jira user
+	self, _, err := jr.User.GetSelf(context.Background())
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "Error getting Jira issues for GitLab Epics")
+		return errors.Wrap(err, "Error getting current user for Jira")
 	}
 
-	//* Get Jira Issues for Issue
-	issueJql := fmt.Sprintf("%s project = %s AND type != Epic Order by key ASC", prefixJql, jiraProjectID)
-	jiraIssues, err := jirax.UnpaginateIssue(jr, issueJql)
+	location, err := time.LoadLocation(self.TimeZone)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "Error getting Jira issues for GitLab Issues")
+		log.Warnf("Unknown Jira time zone %s, using UTC", self.TimeZone)
+		location = time.UTC
 	}
 
-	return jiraEpics, jiraIssues, nil
+	//* JQL has a precision of a minute
+	updated := watermark.Time.Add(-time.Minute).In(location).Format("2006/01/02 15:04")
+	jql := fmt.Sprintf(`updated >= "%s"`, updated)
+	if cfg.Jira.Jql != "" {
+		jql = fmt.Sprintf("(%s) AND %s", cfg.Jira.Jql, jql)
+	}
+
+	log.Infof("Syncing Jira issues updated since %s", updated)
+	return convertByProject(gl, jirax.NewClientSource(jr, cfg.IsJiraCloud()), store, jql, true)
 }
 
-// ! Entry
-func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
+func convertByProject(gl *gitlab.Client, src jirax.Source, store *state.Store, jql string, sync bool) error {
 	var g errgroup.Group
 	g.SetLimit(5)
-	mutex := sync.RWMutex{}
+	mutex := gosync.RWMutex{}
+	startedAt := time.Now()
+	resetSkippedAttachments()
 
 	cfg, err := config.GetConfig()
 	if err != nil {
@@ -67,7 +98,7 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 	jiraProjectID := cfg.Jira.Name
 	gitlabProjectPath := cfg.GitLab.Issue
 
-	jiraProject, _, err := jr.Project.Get(context.Background(), jiraProjectID)
+	jiraProject, err := src.GetProject(jiraProjectID)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error getting Jira project: %s", jiraProjectID))
 	}
@@ -78,39 +109,26 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 	}
 
 	//* Get Jira Issues
-	jiraEpics, jiraIssues, err := GetJiraIssues(jr, jiraProjectID, cfg.Jira.Jql)
-	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Error getting Jira issues: %s", jiraProjectID))
+	expand := []string{}
+	if cfg.Jira.Changelog {
+		expand = append(expand, "changelog")
 	}
 
-	//* User Map
-	userMap, err := newUserMap(gl, append(jiraEpics, jiraIssues...), cfg.Users)
+	jiraEpics, jiraIssues, err := src.GetIssues(jiraProjectID, jql, expand...)
 	if err != nil {
-		return errors.Wrap(err, "Error creating user map")
+		return errors.Wrap(err, fmt.Sprintf("Error getting Jira issues: %s", jiraProjectID))
 	}
 
-	//* Check if Users are members of GitLab project
-	// TODO : Unpaginate
-
-	gitlabProjectMembers, err := gitlabx.Unpaginate[gitlab.ProjectMember](gl, func(opt *gitlab.ListOptions) ([]*gitlab.ProjectMember, *gitlab.Response, error) {
-		return gl.ProjectMembers.ListAllProjectMembers(gitlabProjectPath, &gitlab.ListProjectMembersOptions{ListOptions: *opt})
-	})
+	//* User Map
+	//* Users must be members of GitLab project
+	members, err := getProjectMemberIDs(gl, gitlabProjectPath)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error getting GitLab project members: %s", gitlabProjectPath))
 	}
 
-	for _, user := range userMap {
-		exist := false
-		for _, member := range gitlabProjectMembers {
-			if member.Username == user.Username {
-				exist = true
-				break
-			}
-		}
-
-		if !exist {
-			return errors.Errorf("User %s with id %d is not a member of GitLab project %s", user.Username, user.ID, gitlabProjectPath)
-		}
+	userMap, err := newUserMap(gl, append(jiraEpics, jiraIssues...), cfg, members)
+	if err != nil {
+		return errors.Wrap(err, "Error creating user map")
 	}
 
 	//* Project Description
@@ -146,7 +164,7 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 		if !exist {
 			g.Go(func(version jira.Version) func() error {
 				return func() error {
-					milestone, err := createMilestoneFromJiraVersion(jr, gl, gitlabProject.ID, &version)
+					milestone, err := createMilestoneFromJiraVersion(gl, gitlabProject.ID, &version)
 					if err != nil {
 						return errors.Wrap(err, "Error creating GitLab milestone")
 					}
@@ -154,6 +172,17 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 					mutex.Lock()
 					milestones[version.Name] = milestone
 					mutex.Unlock()
+
+					err = store.Put(&state.Entry{
+						Kind:   state.KindMilestone,
+						Key:    version.Name,
+						ID:     milestone.ID,
+						IID:    milestone.IID,
+						Parent: gitlabProjectPath,
+					})
+					if err != nil {
+						return errors.Wrap(err, "Error recording GitLab milestone")
+					}
 					return nil
 				}
 			}(version))
@@ -164,37 +193,27 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 		return errors.Wrap(err, "Error creating GitLab milestones")
 	}
 
-	//* Project and Group Labels
-	existingGroupLabels := make(map[string]string)
-	existingProjectLabels := make(map[string]string)
-
-	gruopLabels, err := gitlabx.Unpaginate[gitlab.GroupLabel](gl, func(opt *gitlab.ListOptions) ([]*gitlab.GroupLabel, *gitlab.Response, error) {
-		return gl.GroupLabels.ListGroupLabels(cfg.GitLab.Epic, &gitlab.ListGroupLabelsOptions{
-			ListOptions:              *opt,
-			IncludeAncestorGroups:    gitlab.Bool(true),
-			IncludeDescendantGrouops: gitlab.Bool(true),
-			OnlyGroupLabels:          gitlab.Bool(true),
-		})
-	})
+	//* Group Iterations
+	iterations, err := getIterations(gl, src, store, jiraIssues)
 	if err != nil {
-		return errors.Wrap(err, "Error getting GitLab group labels from GitLab")
+		return errors.Wrap(err, "Error creating GitLab iterations")
 	}
 
-	for _, label := range gruopLabels {
-		existingGroupLabels[label.Name] = label.Name
+	//* Project and Group Labels
+	existingGroupLabels, existingProjectLabels, err := getExistingLabels(gl, cfg.GitLab.Epic, gitlabProject.ID)
+	if err != nil {
+		return errors.Wrap(err, "Error getting GitLab labels")
 	}
 
-	projectLabels, err := gitlabx.Unpaginate[gitlab.Label](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Label, *gitlab.Response, error) {
-		return gl.Labels.ListLabels(gitlabProject.ID, &gitlab.ListLabelsOptions{ListOptions: *opt,
-			IncludeAncestorGroups: gitlab.Bool(true),
-		})
-	})
+	//* Epics and Issues imported by a previous run are updated in place
+	importedEpics, err := findImportedEpics(gl, cfg.GitLab.Epic)
 	if err != nil {
-		return errors.Wrap(err, "Error getting GitLab project labels from GitLab")
+		return errors.Wrap(err, "Error finding GitLab epics imported by a previous run")
 	}
 
-	for _, label := range projectLabels {
-		existingProjectLabels[label.Name] = label.Name
+	importedIssues, err := findImportedIssues(gl, gitlabProject.ID)
+	if err != nil {
+		return errors.Wrap(err, "Error finding GitLab issues imported by a previous run")
 	}
 
 	//* Main Game
@@ -206,8 +225,31 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 	for _, jiraEpic := range jiraEpics {
 		g.Go(func(epic *jira.Issue) func() error {
 			return func() error {
-				log.Infof("Converting epic: %s", epic.Key)
-				gitlabEpic, err := ConvertJiraIssueToGitLabEpic(gl, jr, epic, userMap, existingGroupLabels)
+				imported := importedEpics[epic.Key]
+				if entry, ok := store.Get(state.KindEpic, epic.Key); ok {
+					gitlabEpic, resp, err := gl.Epics.GetEpic(entry.Parent, entry.IID)
+					if isNotFound(resp) {
+						//* Deleted by hand since it was recorded, it is created again
+						log.Warnf("Migrated epic %s no longer exists in GitLab, converting it again", epic.Key)
+					} else if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error getting migrated epic: %s", epic.Key))
+					} else if !sync && !entry.Partial {
+						log.Infof("Skipping epic already migrated: %s", epic.Key)
+						mutex.Lock()
+						epicLinks[epic.Key] = &JiraEpicLink{epic, gitlabEpic}
+						mutex.Unlock()
+						return nil
+					} else {
+						imported = gitlabEpic
+					}
+				}
+
+				if imported != nil {
+					log.Infof("Updating epic already imported: %s", epic.Key)
+				} else {
+					log.Infof("Converting epic: %s", epic.Key)
+				}
+				gitlabEpic, err := ConvertJiraIssueToGitLabEpic(gl, src, store, epic, imported, userMap, existingGroupLabels)
 				if err != nil {
 					return errors.Wrap(err, fmt.Sprintf("Error converting epic: %s", epic.Key))
 				}
@@ -216,6 +258,17 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 				epicLinks[epic.Key] = &JiraEpicLink{epic, gitlabEpic}
 				mutex.Unlock()
 
+				err = store.Put(&state.Entry{
+					Kind:   state.KindEpic,
+					Key:    epic.Key,
+					ID:     gitlabEpic.ID,
+					IID:    gitlabEpic.IID,
+					Parent: cfg.GitLab.Epic,
+				})
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error recording epic: %s", epic.Key))
+				}
+
 				return nil
 			}
 		}(jiraEpic))
@@ -230,8 +283,31 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 	for _, jiraIssue := range jiraIssues {
 		g.Go(func(jiraIssue *jira.Issue) func() error {
 			return func() error {
-				log.Infof("Converting issue: %s", jiraIssue.Key)
-				gitlabIssue, err := ConvertJiraIssueToGitLabIssue(gl, jr, jiraIssue, userMap, existingProjectLabels, milestones)
+				imported := importedIssues[jiraIssue.Key]
+				if entry, ok := store.Get(state.KindIssue, jiraIssue.Key); ok {
+					gitlabIssue, resp, err := gl.Issues.GetIssue(entry.Parent, entry.IID)
+					if isNotFound(resp) {
+						//* Deleted by hand since it was recorded, it is created again
+						log.Warnf("Migrated issue %s no longer exists in GitLab, converting it again", jiraIssue.Key)
+					} else if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error getting migrated issue: %s", jiraIssue.Key))
+					} else if !sync && !entry.Partial {
+						log.Infof("Skipping issue already migrated: %s", jiraIssue.Key)
+						mutex.Lock()
+						issueLinks[jiraIssue.Key] = &JiraIssueLink{jiraIssue, gitlabIssue}
+						mutex.Unlock()
+						return nil
+					} else {
+						imported = gitlabIssue
+					}
+				}
+
+				if imported != nil {
+					log.Infof("Updating issue already imported: %s", jiraIssue.Key)
+				} else {
+					log.Infof("Converting issue: %s", jiraIssue.Key)
+				}
+				gitlabIssue, err := ConvertJiraIssueToGitLabIssue(gl, src, store, jiraIssue, imported, userMap, existingProjectLabels, milestones, iterations)
 				if err != nil {
 					return errors.Wrap(err, fmt.Sprintf("Error converting issue: %s", jiraIssue.Key))
 				}
@@ -240,6 +316,17 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 				issueLinks[jiraIssue.Key] = &JiraIssueLink{jiraIssue, gitlabIssue}
 				mutex.Unlock()
 
+				err = store.Put(&state.Entry{
+					Kind:   state.KindIssue,
+					Key:    jiraIssue.Key,
+					ID:     gitlabIssue.ID,
+					IID:    gitlabIssue.IID,
+					Parent: gitlabProjectPath,
+				})
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error recording issue: %s", jiraIssue.Key))
+				}
+
 				return nil
 			}
 		}(jiraIssue))
@@ -250,11 +337,36 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 	}
 
 	//* Link
-	err = Link(gl, jr, epicLinks, issueLinks)
+	//* The epics and issues not updated by a sync are only the targets of the links and references
+	var targetEpics map[string]*gitlab.Epic
+	var targetIssues map[string]*gitlab.Issue
+	if sync {
+		targetEpics = importedEpics
+		targetIssues = importedIssues
+	}
+
+	registryPath, err := config.GetRegistryPath()
+	if err != nil {
+		return errors.Wrap(err, "Error getting registry file path")
+	}
+
+	registry, err := state.Open(registryPath, true)
+	if err != nil {
+		return errors.Wrap(err, "Error opening registry file")
+	}
+	defer registry.Close()
+
+	err = Link(gl, registry, epicLinks, issueLinks, targetEpics, targetIssues)
 	if err != nil {
 		return errors.Wrap(err, "Error linking")
 	}
 
+	//* Jira Key -> GitLab Reference
+	err = RewriteReferences(gl, epicLinks, issueLinks, targetEpics, targetIssues)
+	if err != nil {
+		return errors.Wrap(err, "Error rewriting references")
+	}
+
 	//* Close Milestone
 	for _, milestone := range milestones {
 		if *milestone.JiraVersion.Archived || *milestone.JiraVersion.Released {
@@ -267,7 +379,70 @@ func ConvertByProject(gl *gitlab.Client, jr *jira.Client) error {
 		}
 	}
 
+	//* The next sync starts from this run
+	err = store.Put(&state.Entry{
+		Kind: state.KindSync,
+		Key:  jiraProjectID,
+		Time: startedAt,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error recording sync watermark")
+	}
+
 	log.Infof("You are successfully migrated %s to %s", jiraProjectID, gitlabProjectPath)
 
 	return nil
 }
+
+// getProjectMemberIDs returns the GitLab user IDs of the project members, including the inherited ones.
+func getProjectMemberIDs(gl *gitlab.Client, pid interface{}) (map[int]bool, error) {
+	gitlabProjectMembers, err := gitlabx.Unpaginate[gitlab.ProjectMember](gl, func(opt *gitlab.ListOptions) ([]*gitlab.ProjectMember, *gitlab.Response, error) {
+		return gl.ProjectMembers.ListAllProjectMembers(pid, &gitlab.ListProjectMembersOptions{ListOptions: *opt})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[int]bool)
+	for _, member := range gitlabProjectMembers {
+		members[member.ID] = true
+	}
+	return members, nil
+}
+
+// Label Name -> Label Name
+func getExistingLabels(gl *gitlab.Client, gid interface{}, pid interface{}) (map[string]string, map[string]string, error) {
+	existingGroupLabels := make(map[string]string)
+	existingProjectLabels := make(map[string]string)
+
+	gruopLabels, err := gitlabx.Unpaginate[gitlab.GroupLabel](gl, func(opt *gitlab.ListOptions) ([]*gitlab.GroupLabel, *gitlab.Response, error) {
+		return gl.GroupLabels.ListGroupLabels(gid, &gitlab.ListGroupLabelsOptions{
+			ListOptions:              *opt,
+			IncludeAncestorGroups:    gitlab.Bool(true),
+			IncludeDescendantGrouops: gitlab.Bool(true),
+			OnlyGroupLabels:          gitlab.Bool(true),
+		})
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error getting GitLab group labels from GitLab")
+	}
+
+	for _, label := range gruopLabels {
+		existingGroupLabels[label.Name] = label.Name
+	}
+
+	projectLabels, err := gitlabx.Unpaginate[gitlab.Label](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Label, *gitlab.Response, error) {
+		return gl.Labels.ListLabels(pid, &gitlab.ListLabelsOptions{ListOptions: *opt,
+			IncludeAncestorGroups: gitlab.Bool(true),
+		})
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error getting GitLab project labels from GitLab")
+	}
+
+	for _, label := range projectLabels {
+		existingProjectLabels[label.Name] = label.Name
+	}
+
+	return existingGroupLabels, existingProjectLabels, nil
+}
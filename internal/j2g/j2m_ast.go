@@ -0,0 +1,64 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+// The Jira wiki markup is parsed into a tree of wikiNode, then rendered to GitLab Markdown.
+// - Block nodes are one or more lines of the text, a document is its blocks joined by new lines.
+// - Inline nodes are the content of a block.
+
+type wikiKind int
+
+const (
+	//* Block
+	wikiDocument   wikiKind = iota
+	wikiParagraph           // A line of text, possibly empty
+	wikiHeading             // h1. ~ h6.
+	wikiRule                // ----
+	wikiListItem            // * item, # item
+	wikiTable               // Children: rows
+	wikiTableRow            // Children: cells
+	wikiTableCell           // ||header|| or |cell|
+	wikiQuote               // {quote}
+	wikiBlockQuote          // bq.
+	wikiCodeBlock           // {code}, {noformat}
+	wikiAlert               // {panel}, {info}, {note}, {warning}, {tip}
+	wikiExpand              // {expand}
+
+	//* Inline
+	wikiText
+	wikiStrong         // *strong*
+	wikiEmphasis       // _emphasis_, ??citation??
+	wikiStrikethrough  // -deleted-
+	wikiUnderline      // +inserted+
+	wikiSuperscript    // ^superscript^
+	wikiSubscript      // ~subscript~
+	wikiCode           // {{monospaced}}
+	wikiLineBreak      // \\
+	wikiMention        // [~username]
+	wikiLink           // [text|url]
+	wikiMailto         // [text|mailto:email]
+	wikiAttachmentLink // [^filename]
+	wikiImage          // !filename|metadata!
+)
+
+type wikiNode struct {
+	Kind wikiKind
+
+	Text    string            //* Text, code, username, filename, alert type
+	URL     string            //* Link target
+	Level   int               //* Heading level, list depth
+	Ordered bool              //* Numbered list item
+	Header  bool              //* Table header cell
+	Attrs   map[string]string //* Macro and image parameters
+
+	Children []*wikiNode
+}
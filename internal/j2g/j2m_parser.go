@@ -0,0 +1,663 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	wikiNewlineRegex    = regexp.MustCompile(`\r\n|\n\r|\r`)
+	wikiBlockMacroRegex = regexp.MustCompile(`^\{(code|noformat|quote|panel|info|note|warning|tip|expand)(?::([^}]*))?\}`)
+	wikiHeadingRegex    = regexp.MustCompile(`^\s*h([1-6])\.\s*(.*)$`)
+	wikiRuleRegex       = regexp.MustCompile(`^\s*-{4,}\s*$`)
+	wikiBlockQuoteRegex = regexp.MustCompile(`^\s*bq\.\s?(.*)$`)
+	wikiListItemRegex   = regexp.MustCompile(`^\s*([*#]+|-)\s+(.*)$`)
+	wikiMacroMetaRegex  = regexp.MustCompile(`^ *([^=]+?)(?:=(.*?))? *$`)
+
+	//* Inline macros without Markdown equivalent, the content is kept
+	wikiDroppedMacroRegex = regexp.MustCompile(`^\{(?:color|anchor)(?::[^}]*)?\}`)
+)
+
+// parseWiki parses the Jira wiki markup into a document
+func parseWiki(str string) *wikiNode {
+	str = wikiNewlineRegex.ReplaceAllString(str, "\n")
+	return &wikiNode{Kind: wikiDocument, Children: parseWikiBlocks(str)}
+}
+
+//* Block
+
+func parseWikiBlocks(str string) []*wikiNode {
+	lines := strings.Split(str, "\n")
+	blocks := []*wikiNode{}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		//* Macros may span multiple lines, and their content is not a line of the document.
+		if match := wikiBlockMacroRegex.FindStringSubmatch(strings.TrimLeft(line, " \t")); match != nil {
+			name, meta := match[1], match[2]
+			rest := strings.TrimLeft(line, " \t")[len(match[0]):]
+			if content, after, end, ok := findWikiMacroEnd(lines, i, rest, name); ok {
+				blocks = append(blocks, newWikiMacro(name, parseWikiMacroMeta(meta), content))
+				if strings.TrimSpace(after) != "" {
+					lines[end] = after
+					i = end - 1
+				} else {
+					i = end
+				}
+				continue
+			}
+		}
+
+		line = stripWikiMacros(line)
+
+		if match := wikiHeadingRegex.FindStringSubmatch(line); match != nil {
+			level, _ := strconv.Atoi(match[1])
+			blocks = append(blocks, &wikiNode{Kind: wikiHeading, Level: level, Children: parseWikiInline(match[2])})
+			continue
+		}
+
+		if wikiRuleRegex.MatchString(line) {
+			blocks = append(blocks, &wikiNode{Kind: wikiRule})
+			continue
+		}
+
+		if match := wikiBlockQuoteRegex.FindStringSubmatch(line); match != nil {
+			blocks = append(blocks, &wikiNode{Kind: wikiBlockQuote, Children: parseWikiInline(match[1])})
+			continue
+		}
+
+		if match := wikiListItemRegex.FindStringSubmatch(line); match != nil {
+			bullets := match[1]
+			blocks = append(blocks, &wikiNode{
+				Kind:     wikiListItem,
+				Level:    len(bullets),
+				Ordered:  bullets[len(bullets)-1] == '#',
+				Children: parseWikiInline(match[2]),
+			})
+			continue
+		}
+
+		if strings.HasPrefix(strings.TrimSpace(line), "|") {
+			table := &wikiNode{Kind: wikiTable}
+			for ; i < len(lines); i++ {
+				row := strings.TrimSpace(stripWikiMacros(lines[i]))
+				if !strings.HasPrefix(row, "|") {
+					break
+				}
+				table.Children = append(table.Children, parseWikiTableRow(row))
+			}
+			i--
+			blocks = append(blocks, table)
+			continue
+		}
+
+		blocks = append(blocks, &wikiNode{Kind: wikiParagraph, Children: parseWikiInline(line)})
+	}
+
+	return blocks
+}
+
+// findWikiMacroEnd finds the closing tag of the macro opened on the line start.
+// It returns the content of the macro, the text after the closing tag and the line of the closing tag.
+func findWikiMacroEnd(lines []string, start int, rest string, name string) (string, string, int, bool) {
+	closing := "{" + name + "}"
+
+	var content strings.Builder
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		if i == start {
+			line = rest
+		} else {
+			content.WriteString("\n")
+		}
+
+		if idx := strings.Index(line, closing); idx >= 0 {
+			content.WriteString(line[:idx])
+			return content.String(), line[idx+len(closing):], i, true
+		}
+		content.WriteString(line)
+	}
+
+	return "", "", 0, false
+}
+
+func newWikiMacro(name string, meta map[string]string, content string) *wikiNode {
+	switch name {
+	case "code", "noformat":
+		content = strings.TrimPrefix(content, "\n")
+		content = strings.TrimSuffix(content, "\n")
+		return &wikiNode{Kind: wikiCodeBlock, Text: content, Attrs: meta}
+	case "quote":
+		return &wikiNode{Kind: wikiQuote, Children: parseWikiBlocks(content)}
+	case "expand":
+		return &wikiNode{Kind: wikiExpand, Attrs: meta, Children: parseWikiBlocks(strings.Trim(content, "\n"))}
+	default: // panel, info, note, warning, tip
+		return &wikiNode{Kind: wikiAlert, Text: wikiMacroAlerts[name], Attrs: meta, Children: parseWikiBlocks(strings.Trim(content, "\n"))}
+	}
+}
+
+// Jira macro -> GitLab alert type
+var wikiMacroAlerts = map[string]string{
+	"panel":   "note",
+	"info":    "note",
+	"note":    "note",
+	"tip":     "tip",
+	"warning": "warning",
+}
+
+// parseWikiMacroMeta parses the parameters of a macro, e.g. {code:java|title=Main.java}.
+// A parameter without a value is stored with an empty key.
+func parseWikiMacroMeta(meta string) map[string]string {
+	result := map[string]string{}
+	if meta == "" {
+		return result
+	}
+
+	for _, v := range strings.Split(meta, "|") {
+		match := wikiMacroMetaRegex.FindStringSubmatch(v)
+		if match == nil {
+			continue
+		}
+		if strings.Contains(v, "=") {
+			result[match[1]] = match[2]
+		} else {
+			result[""] = match[1]
+		}
+	}
+	return result
+}
+
+func stripWikiMacros(line string) string {
+	if !strings.Contains(line, "{") {
+		return line
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '{' {
+			if loc := wikiDroppedMacroRegex.FindStringIndex(line[i:]); loc != nil {
+				i += loc[1] - 1
+				continue
+			}
+		}
+		b.WriteByte(line[i])
+	}
+	return b.String()
+}
+
+// parseWikiTableRow parses a row of a table. The cells after || are headers.
+func parseWikiTableRow(row string) *wikiNode {
+	result := &wikiNode{Kind: wikiTableRow}
+
+	depth := 0
+	header := false
+	start := -1
+	closeCell := func(end int) {
+		if start >= 0 {
+			result.Children = append(result.Children, &wikiNode{
+				Kind:     wikiTableCell,
+				Header:   header,
+				Children: parseWikiInline(strings.TrimSpace(row[start:end])),
+			})
+		}
+	}
+
+	for i := 0; i < len(row); i++ {
+		switch row[i] {
+		case '[', '{':
+			depth++
+		case ']', '}':
+			if depth > 0 {
+				depth--
+			}
+		case '|':
+			if depth > 0 {
+				continue
+			}
+			closeCell(i)
+			header = i+1 < len(row) && row[i+1] == '|'
+			if header {
+				i++
+			}
+			start = i + 1
+		}
+	}
+
+	//* The last cell is not closed by |
+	if start >= 0 && strings.TrimSpace(row[start:]) != "" {
+		closeCell(len(row))
+	}
+
+	return result
+}
+
+//* Inline
+
+type wikiTokenKind int
+
+const (
+	wikiTokenText wikiTokenKind = iota
+	wikiTokenDelimiter
+	wikiTokenCode
+	wikiTokenLink
+	wikiTokenImage
+	wikiTokenLineBreak
+)
+
+type wikiToken struct {
+	kind wikiTokenKind
+	text string
+
+	//* Delimiter
+	braced   bool // {*}strong{*}, may open and close anywhere
+	canOpen  bool
+	canClose bool
+}
+
+var wikiDelimiterKinds = map[string]wikiKind{
+	"*":  wikiStrong,
+	"_":  wikiEmphasis,
+	"??": wikiEmphasis,
+	"-":  wikiStrikethrough,
+	"+":  wikiUnderline,
+	"^":  wikiSuperscript,
+	"~":  wikiSubscript,
+}
+
+// emojis are the Jira emoticons, the longer ones must be checked first.
+var emojis = []struct{ jira, gitlab string }{
+	{"(*r)", "⭐"},
+	{"(*g)", "⭐"},
+	{"(*b)", "⭐"},
+	{"(*y)", "⭐"},
+	{"(off)", "💡"},
+	{"(on)", "💡"},
+	{"(y)", "👍"},
+	{"(n)", "👎"},
+	{"(!)", "⚠"},
+	{"(*)", "⭐"},
+	{"(/)", "🏁"},
+	{"(x)", "❌"},
+	{"(i)", "ℹ"},
+	{"(+)", "➕"},
+	{"(-)", "➖"},
+	{"(?)", "❓"},
+	{"</3", "💔"},
+	{"<3", "❤"},
+	{":)", "😄"},
+	{":(", "😦"},
+	{":P", "😛"},
+	{":D", "😃"},
+	{";)", "😉"},
+}
+
+func parseWikiInline(str string) []*wikiNode {
+	return buildWikiInline(tokenizeWikiInline(str))
+}
+
+// tokenizeWikiInline splits a text into tokens. The formatting delimiters are
+// marked with whether they can open or close a formatting, matched by the parser.
+func tokenizeWikiInline(str string) []wikiToken {
+	runes := []rune(str)
+	tokens := []wikiToken{}
+
+	//* The byte offset of each rune, to match prefixes without copying the rest of the text
+	offsets := make([]int, 0, len(runes)+1)
+	for offset := range str {
+		offsets = append(offsets, offset)
+	}
+	offsets = append(offsets, len(str))
+
+	//* The ends of code, links and images are searched from increasing positions
+	codeEnds := newRuneFinder(runes, "}}")
+	linkEnds := newRuneFinder(runes, "]")
+	imageEnds := newRuneFinder(runes, "!")
+
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			tokens = append(tokens, wikiToken{kind: wikiTokenText, text: text.String()})
+			text.Reset()
+		}
+	}
+	emit := func(token wikiToken) {
+		flush()
+		tokens = append(tokens, token)
+	}
+	at := func(i int) rune {
+		if i < 0 || i >= len(runes) {
+			return ' '
+		}
+		return runes[i]
+	}
+	hasPrefix := func(i int, prefix string) bool {
+		return strings.HasPrefix(str[offsets[i]:], prefix)
+	}
+
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		//* \\ is a line break, \ escapes the next character
+		case c == '\\':
+			if at(i+1) == '\\' {
+				emit(wikiToken{kind: wikiTokenLineBreak})
+				i++
+			} else if i+1 < len(runes) {
+				text.WriteRune(runes[i+1])
+				i++
+			} else {
+				text.WriteRune(c)
+			}
+			continue
+
+		case c == '{':
+			rest := str[offsets[i]:]
+			if strings.HasPrefix(rest, "{{") {
+				if end := codeEnds.index(i + 2); end > i+2 {
+					emit(wikiToken{kind: wikiTokenCode, text: string(runes[i+2 : end])})
+					i = end + 1
+					continue
+				}
+			}
+			if loc := wikiDroppedMacroRegex.FindStringIndex(rest); loc != nil {
+				i += utf8.RuneCountInString(rest[:loc[1]]) - 1
+				continue
+			}
+			if marker, ok := wikiBracedDelimiter(rest); ok {
+				emit(wikiToken{kind: wikiTokenDelimiter, text: marker, braced: true, canOpen: true, canClose: true})
+				i += len(marker) + 1
+				continue
+			}
+
+		case c == '[':
+			if end := linkEnds.index(i + 1); end > i+1 {
+				emit(wikiToken{kind: wikiTokenLink, text: string(runes[i+1 : end])})
+				i = end
+				continue
+			}
+
+		case c == '!':
+			if end := imageEnds.index(i + 1); end > i+1 {
+				content := string(runes[i+1 : end])
+				name := strings.SplitN(content, "|", 2)[0]
+				if name != "" && !strings.ContainsAny(name, " \t") && !strings.HasPrefix(content, "|") {
+					emit(wikiToken{kind: wikiTokenImage, text: content})
+					i = end
+					continue
+				}
+			}
+		}
+
+		//* -- and --- surrounded by spaces are dashes
+		if c == '-' {
+			n := 1
+			for at(i+n) == '-' {
+				n++
+			}
+			if n > 1 {
+				if (n == 2 || n == 3) && unicode.IsSpace(at(i-1)) && unicode.IsSpace(at(i+n)) {
+					text.WriteString(map[int]string{2: "–", 3: "—"}[n])
+				} else {
+					text.WriteString(strings.Repeat("-", n))
+				}
+				i += n - 1
+				continue
+			}
+		}
+
+		//* Emoticons
+		if !isWikiWordRune(at(i - 1)) {
+			matched := false
+			for _, emoji := range emojis {
+				if hasPrefix(i, emoji.jira) && !isWikiWordRune(at(i+len([]rune(emoji.jira)))) {
+					text.WriteString(emoji.gitlab)
+					i += len([]rune(emoji.jira)) - 1
+					matched = true
+					break
+				}
+			}
+			if matched {
+				continue
+			}
+		}
+
+		//* Delimiters, a run of the same character is not a delimiter except ??
+		marker := string(c)
+		if c == '?' && at(i+1) == '?' && at(i+2) != '?' {
+			marker = "??"
+		}
+		if _, ok := wikiDelimiterKinds[marker]; ok && (marker == "??" || (at(i+1) != c && at(i-1) != c)) {
+			size := len([]rune(marker))
+			emit(wikiToken{
+				kind:     wikiTokenDelimiter,
+				text:     marker,
+				canOpen:  !isWikiWordRune(at(i-1)) && i+size < len(runes) && !unicode.IsSpace(at(i+size)),
+				canClose: i > 0 && !unicode.IsSpace(at(i-1)) && !isWikiWordRune(at(i+size)),
+			})
+			i += size - 1
+			continue
+		}
+
+		text.WriteRune(c)
+	}
+
+	flush()
+	return tokens
+}
+
+func wikiBracedDelimiter(str string) (string, bool) {
+	for marker := range wikiDelimiterKinds {
+		if strings.HasPrefix(str, "{"+marker+"}") {
+			return marker, true
+		}
+	}
+	return "", false
+}
+
+// buildWikiInline matches the delimiters from the innermost, and the unmatched delimiters are left as text
+func buildWikiInline(tokens []wikiToken) []*wikiNode {
+	type opener struct {
+		token wikiToken
+		index int // index of the delimiter node in nodes
+	}
+
+	nodes := []*wikiNode{}
+	openers := []opener{}
+
+	//* The indexes in openers of each delimiter, so a closer finds its opener without scanning the others
+	key := func(token wikiToken) string {
+		if token.braced {
+			return "{" + token.text + "}"
+		}
+		return token.text
+	}
+	openersByKey := make(map[string][]int)
+
+	for _, token := range tokens {
+		switch token.kind {
+		case wikiTokenText:
+			nodes = append(nodes, &wikiNode{Kind: wikiText, Text: token.text})
+		case wikiTokenCode:
+			nodes = append(nodes, &wikiNode{Kind: wikiCode, Text: token.text})
+		case wikiTokenLineBreak:
+			nodes = append(nodes, &wikiNode{Kind: wikiLineBreak})
+		case wikiTokenLink:
+			nodes = append(nodes, parseWikiLink(token.text))
+		case wikiTokenImage:
+			nodes = append(nodes, parseWikiImage(token.text))
+		case wikiTokenDelimiter:
+			if token.canClose {
+				found := -1
+				if indexes := openersByKey[key(token)]; len(indexes) > 0 {
+					found = indexes[len(indexes)-1]
+				}
+
+				//* Empty formatting is not a formatting
+				if found >= 0 && openers[found].index+1 < len(nodes) && !isWikiDashes(nodes[openers[found].index+1:], token.text) {
+					start := openers[found].index
+					element := &wikiNode{
+						Kind:     wikiDelimiterKinds[token.text],
+						Children: append([]*wikiNode{}, nodes[start+1:]...),
+					}
+					nodes = append(nodes[:start], element)
+
+					//* The openers inside the formatting are the last of their delimiter
+					for j := len(openers) - 1; j >= found; j-- {
+						k := key(openers[j].token)
+						openersByKey[k] = openersByKey[k][:len(openersByKey[k])-1]
+					}
+					openers = openers[:found]
+					continue
+				}
+			}
+
+			literal := token.text
+			if token.braced {
+				literal = "{" + literal + "}"
+			}
+			nodes = append(nodes, &wikiNode{Kind: wikiText, Text: literal})
+			if token.canOpen {
+				openersByKey[key(token)] = append(openersByKey[key(token)], len(openers))
+				openers = append(openers, opener{token, len(nodes) - 1})
+			}
+		}
+	}
+
+	return nodes
+}
+
+// isWikiDashes reports whether a strikethrough would only contain dashes, e.g. ------
+func isWikiDashes(nodes []*wikiNode, marker string) bool {
+	if marker != "-" {
+		return false
+	}
+	for _, node := range nodes {
+		if node.Kind != wikiText || strings.Trim(node.Text, "-") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+var wikiSmartLinks = map[string]bool{
+	"smart-link":  true,
+	"smart-card":  true,
+	"smart-embed": true,
+}
+
+// parseWikiLink parses the content of [...]
+func parseWikiLink(content string) *wikiNode {
+	switch {
+	case strings.HasPrefix(content, "~"):
+		return &wikiNode{Kind: wikiMention, Text: strings.TrimPrefix(content[1:], "accountid:")}
+	case strings.HasPrefix(content, "^"):
+		return &wikiNode{Kind: wikiAttachmentLink, Text: content[1:]}
+	}
+
+	text, target := "", content
+	if idx := strings.LastIndex(content, "|"); idx >= 0 {
+		text, target = content[:idx], content[idx+1:]
+		if wikiSmartLinks[strings.TrimSpace(target)] {
+			text, target = "", text
+			if idx := strings.LastIndex(target, "|"); idx >= 0 {
+				text, target = target[:idx], target[idx+1:]
+			}
+		}
+	}
+	target = strings.TrimSpace(target)
+
+	switch {
+	case strings.HasPrefix(target, "#"): //* Anchors are not supported, only the name is kept
+		if text == "" {
+			text = target[1:]
+		}
+		return &wikiNode{Kind: wikiText, Text: text}
+	case strings.HasPrefix(target, "mailto:"):
+		return &wikiNode{Kind: wikiMailto, Text: text, URL: target}
+	case strings.HasPrefix(target, "http"), strings.HasPrefix(target, "ftp:"), strings.HasPrefix(target, "file:"):
+		node := &wikiNode{Kind: wikiLink, URL: target}
+		if text == "" {
+			node.Children = []*wikiNode{{Kind: wikiText, Text: target}}
+		} else {
+			node.Children = parseWikiInline(text)
+		}
+		return node
+	default:
+		return &wikiNode{Kind: wikiText, Text: "[" + content + "]"}
+	}
+}
+
+// parseWikiImage parses the content of !...!, e.g. !image.png|width=300!
+func parseWikiImage(content string) *wikiNode {
+	parts := strings.SplitN(content, "|", 2)
+	node := &wikiNode{Kind: wikiImage, Text: parts[0], Attrs: map[string]string{}}
+	if len(parts) == 2 {
+		for _, v := range strings.Split(parts[1], ",") {
+			kv := strings.SplitN(v, "=", 2)
+			if len(kv) == 2 {
+				node.Attrs[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+			} else {
+				node.Attrs[strings.TrimSpace(kv[0])] = ""
+			}
+		}
+	}
+	return node
+}
+
+// runeFinder returns the index of the next occurrence of a sequence, searched from increasing positions.
+// The last match is kept until the position passes it, so all the searches of a text are linear.
+type runeFinder struct {
+	runes []rune
+	seq   []rune
+	next  int // Index of the last match, len(runes) if there is none after the last search
+}
+
+func newRuneFinder(runes []rune, seq string) *runeFinder {
+	return &runeFinder{runes: runes, seq: []rune(seq), next: -1}
+}
+
+func (f *runeFinder) index(from int) int {
+	if f.next < from {
+		f.next = len(f.runes)
+		for i := from; i+len(f.seq) <= len(f.runes); i++ {
+			if f.match(i) {
+				f.next = i
+				break
+			}
+		}
+	}
+	if f.next >= len(f.runes) {
+		return -1
+	}
+	return f.next
+}
+
+func (f *runeFinder) match(i int) bool {
+	for j, r := range f.seq {
+		if f.runes[i+j] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// isWikiWordRune is \w of the regular expressions, the formatting delimiters are only in the boundaries of words
+func isWikiWordRune(r rune) bool {
+	return r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9')
+}
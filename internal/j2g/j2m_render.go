@@ -0,0 +1,271 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+type wikiRenderer struct {
+	attachments     AttachmentMap
+	userMap         UserMap
+	usedAttachments []string
+}
+
+func (r *wikiRenderer) renderBlocks(blocks []*wikiNode) (string, error) {
+	lines := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		line, err := r.renderBlock(block)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (r *wikiRenderer) renderBlock(node *wikiNode) (string, error) {
+	switch node.Kind {
+	case wikiDocument:
+		return r.renderBlocks(node.Children)
+
+	case wikiParagraph:
+		return r.renderInline(node.Children)
+
+	case wikiHeading:
+		content, err := r.renderInline(node.Children)
+		if err != nil {
+			return "", err
+		}
+		return strings.Repeat("#", node.Level) + " " + content, nil
+
+	case wikiRule:
+		return "---", nil
+
+	case wikiListItem:
+		content, err := r.renderInline(node.Children)
+		if err != nil {
+			return "", err
+		}
+		bullet := "*"
+		if node.Ordered {
+			bullet = "1."
+		}
+		return strings.Repeat("  ", node.Level-1) + bullet + " " + content, nil
+
+	case wikiBlockQuote:
+		content, err := r.renderInline(node.Children)
+		if err != nil {
+			return "", err
+		}
+		return "> " + content, nil
+
+	case wikiQuote:
+		content, err := r.renderBlocks(node.Children)
+		if err != nil {
+			return "", err
+		}
+		return "\n> " + strings.ReplaceAll(content, "\n", "\n> "), nil
+
+	case wikiCodeBlock:
+		return fmt.Sprintf("```%s\n%s\n```", codeBlockLanguage(node.Attrs), node.Text), nil
+
+	//* Alerts and collapsible sections are separated by blank lines, not to continue a paragraph
+	case wikiAlert:
+		content, err := r.renderBlocks(node.Children)
+		if err != nil {
+			return "", err
+		}
+		header := fmt.Sprintf("> [!%s]", node.Text)
+		if title := node.Attrs["title"]; title != "" {
+			header += " " + title
+		}
+		return "\n" + header + "\n" + prefixLines(content, "> ", "> ") + "\n", nil
+
+	case wikiExpand:
+		content, err := r.renderBlocks(node.Children)
+		if err != nil {
+			return "", err
+		}
+		title := node.Attrs[""]
+		if title == "" {
+			title = node.Attrs["title"]
+		}
+		if title == "" {
+			title = "Details"
+		}
+		return fmt.Sprintf("\n<details><summary>%s</summary>\n\n%s\n\n</details>\n", title, content), nil
+
+	case wikiTable:
+		return r.renderTable(node)
+	}
+
+	return "", errors.Errorf("unknown block: %d", node.Kind)
+}
+
+// codeBlockLanguage returns the language of {code:java} or {code:title=Main.java}
+func codeBlockLanguage(attrs map[string]string) string {
+	if lang, ok := attrs[""]; ok {
+		return lang
+	}
+	if title, ok := attrs["title"]; ok {
+		arr := strings.Split(title, ".")
+		return arr[len(arr)-1]
+	}
+	return ""
+}
+
+func (r *wikiRenderer) renderTable(node *wikiNode) (string, error) {
+	rows := [][]string{}
+	columns := 0
+	for _, row := range node.Children {
+		cells := []string{}
+		for _, cell := range row.Children {
+			content, err := r.renderInline(cell.Children)
+			if err != nil {
+				return "", err
+			}
+			cells = append(cells, strings.ReplaceAll(content, "|", "\\|"))
+		}
+		if len(cells) > columns {
+			columns = len(cells)
+		}
+		rows = append(rows, cells)
+	}
+
+	//* The first row is the header of Markdown tables
+	lines := []string{}
+	for i, cells := range rows {
+		for len(cells) < columns {
+			cells = append(cells, "")
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+		if i == 0 {
+			lines = append(lines, "|"+strings.Repeat(" --- |", columns))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (r *wikiRenderer) renderInline(nodes []*wikiNode) (string, error) {
+	var b strings.Builder
+	spaceAfter := false //* after a mention
+
+	for _, node := range nodes {
+		s, err := r.renderInlineNode(node)
+		if err != nil {
+			return "", err
+		}
+
+		if spaceAfter && s != "" && isWikiWordRune([]rune(s)[0]) {
+			b.WriteString(" ")
+		}
+		spaceAfter = false
+
+		//* Mentions must be separated from the words
+		if node.Kind == wikiMention {
+			if current := []rune(b.String()); len(current) > 0 && isWikiWordRune(current[len(current)-1]) {
+				b.WriteString(" ")
+			}
+			spaceAfter = true
+		}
+
+		b.WriteString(s)
+	}
+
+	return b.String(), nil
+}
+
+func (r *wikiRenderer) renderInlineNode(node *wikiNode) (string, error) {
+	wrap := func(before, after string) (string, error) {
+		content, err := r.renderInline(node.Children)
+		if err != nil {
+			return "", err
+		}
+		return before + content + after, nil
+	}
+
+	switch node.Kind {
+	case wikiText:
+		return node.Text, nil
+	case wikiStrong:
+		return wrap("**", "**")
+	case wikiEmphasis:
+		return wrap("*", "*")
+	case wikiStrikethrough:
+		return wrap("~~", "~~")
+	case wikiUnderline:
+		return wrap("<ins>", "</ins>")
+	case wikiSuperscript:
+		return wrap("<sup>", "</sup>")
+	case wikiSubscript:
+		return wrap("<sub>", "</sub>")
+	case wikiCode:
+		return "`" + node.Text + "`", nil
+	case wikiLineBreak:
+		return "<br>", nil
+
+	case wikiMention:
+		user, ok := r.userMap[node.Text]
+		if !ok {
+			return "", errors.Errorf("user not found: %s", node.Text)
+		}
+		return "@" + user.Username, nil
+
+	case wikiLink:
+		return wrap("[", "]("+node.URL+")")
+
+	case wikiMailto:
+		name := node.Text
+		if name == "" {
+			name = strings.TrimPrefix(node.URL, "mailto:")
+		}
+		return fmt.Sprintf("[%s✉️](%s)", name, node.URL), nil
+
+	case wikiAttachmentLink:
+		attachment, ok := r.attachments[node.Text]
+		if !ok {
+			log.Debugf("attachment not found: %s", node.Text)
+			return fmt.Sprintf("[^%s]", node.Text), nil
+		}
+		r.usedAttachments = append(r.usedAttachments, node.Text)
+		if attachment.Rejected {
+			return attachment.Markdown, nil
+		}
+		return fmt.Sprintf("[%s](%s)", attachment.Alt, attachment.URL), nil
+
+	case wikiImage:
+		attachment, ok := r.attachments[node.Text]
+		if !ok {
+			log.Debugf("attachment not found: %s", node.Text)
+			return fmt.Sprintf("![%s](%s)", node.Text, node.Text), nil
+		}
+		r.usedAttachments = append(r.usedAttachments, node.Text)
+
+		size := ""
+		for _, key := range []string{"width", "height"} {
+			if value := node.Attrs[key]; value != "" && strings.Trim(value, "0123456789") == "" {
+				size += fmt.Sprintf(" %s=\"%s\"", key, value)
+			}
+		}
+		if size != "" && !attachment.Rejected {
+			return fmt.Sprintf(`<img src="%s" alt="%s"%s>`, attachment.URL, attachment.Alt, size), nil
+		}
+		return attachment.Markdown, nil
+	}
+
+	return "", errors.Errorf("unknown inline: %d", node.Kind)
+}
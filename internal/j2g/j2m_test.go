@@ -11,7 +11,9 @@
 package j2g
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/xanzy/go-gitlab"
 )
@@ -45,6 +47,10 @@ var testCases = []struct {
 		input:       "What [~jeff] said!",
 		expected:    "What @infograb-jeff said!",
 		description: "User mention",
+	}, {
+		input:       "What [~accountid:jeff] said!",
+		expected:    "What @infograb-jeff said!",
+		description: "Jira Cloud user mention",
 	}, {
 		input:       "{*}bold{*} [~admin] said!",
 		expected:    "**bold** @dexter.shin said!",
@@ -111,6 +117,46 @@ var testCases = []struct {
 		input:       "h1. Headin{*}g 1{*}",
 		expected:    "# Headin**g 1**",
 	},
+	{
+		description: "Nested formatting",
+		input:       "*bold _italic_ and -deleted-* text",
+		expected:    "**bold *italic* and ~~deleted~~** text",
+	},
+	{
+		description: "Formatting in a link",
+		input:       "[*GitLab*|https://gitlab.com]",
+		expected:    "[**GitLab**](https://gitlab.com)",
+	},
+	{
+		description: "List containing code",
+		input:       "* item {{a*b*c}}\n** sub item\n# one",
+		expected:    "* item `a*b*c`\n  * sub item\n1. one",
+	},
+	{
+		description: "Code block is not converted",
+		input:       "{code:java}\n*not bold* <codeblock>\n{code}\ntext <codeblock>",
+		expected:    "```java\n*not bold* <codeblock>\n```\ntext <codeblock>",
+	},
+	{
+		description: "Panel",
+		input:       "{panel:title=Result|borderStyle=dashed}\n||a||b||\n|c|[d|https://d.com]|\n{panel}",
+		expected:    "\n> [!note] Result\n> | a | b |\n> | --- | --- |\n> | c | [d](https://d.com) |\n",
+	},
+	{
+		description: "Info, note, warning and tip",
+		input:       "{info}*Read* this{info}\n{note:title=Note}x{note}\n{warning}\n# one\n\n# two\n{warning}\n{tip}y{tip}",
+		expected:    "\n> [!note]\n> **Read** this\n\n\n> [!note] Note\n> x\n\n\n> [!warning]\n> 1. one\n>\n> 1. two\n\n\n> [!tip]\n> y\n",
+	},
+	{
+		description: "Expand",
+		input:       "{expand:Logs}\n{code}panic: oops{code}\n{expand}\n{expand}text{expand}",
+		expected:    "\n<details><summary>Logs</summary>\n\n```\npanic: oops\n```\n\n</details>\n\n\n<details><summary>Details</summary>\n\ntext\n\n</details>\n",
+	},
+	{
+		description: "Dashes and emoticons",
+		input:       "a -- b --- c (y) snake_case_name",
+		expected:    "a – b — c 👍 snake_case_name",
+	},
 
 	// * 여기서부터 공식 문서대로 하나씩 (https://jira.atlassian.com/secure/WikiRendererHelpAction.jspa?section=all)
 	{
@@ -176,3 +222,34 @@ func TestJiraToMD(t *testing.T) {
 		}
 	}
 }
+
+// The long lines of pasted logs and JSON are converted in linear time
+var longLines = map[string]string{
+	"prose":      strings.Repeat("Hello (world), this is *some* text: with [brackets] and {braces} ok. ", 450),
+	"json":       strings.Repeat(`{"key": [1, 2, {"a": "b"}], "x": "y_z"}, `, 800),
+	"delimiters": strings.Repeat("*a ", 4000),
+	"openers":    strings.Repeat("[{{!", 8000),
+}
+
+func TestJiraToMDLongLine(t *testing.T) {
+	for name, input := range longLines {
+		start := time.Now()
+		if _, _, err := JiraToMD(input, attachments, userMap); err != nil {
+			t.Errorf("Error: %s", err)
+		}
+		//* A quadratic conversion takes tens of seconds
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("JiraToMD() of %d bytes of %s took %s", len(input), name, elapsed)
+		}
+	}
+}
+
+func BenchmarkJiraToMDLongLine(b *testing.B) {
+	for name, input := range longLines {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				JiraToMD(input, attachments, userMap)
+			}
+		})
+	}
+}
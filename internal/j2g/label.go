@@ -18,58 +18,74 @@ import (
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/state"
 	"gitlab.com/infograb-public/j2lab/internal/utils"
 )
 
-func convertJiraToGitLabLabels(gl *gitlab.Client, id interface{}, jiraIssue *jira.Issue, existingLabels map[string]string, isGroup bool) (*gitlab.Labels, error) {
-	labels := jiraIssue.Fields.Labels
+type labelSpec struct {
+	name        string
+	description string
+}
+
+// jiraIssueLabels returns the GitLab labels of the Jira issue. Only the labels with a description need to be created.
+func jiraIssueLabels(cfg *config.Config, jiraIssue *jira.Issue) (labels []string, specs []labelSpec) {
+	labels = append(labels, jiraIssue.Fields.Labels...)
 
 	//* Issue Type
-	issueType := fmt.Sprintf("type::%s", jiraIssue.Fields.Type.Name)
-	if _, ok := existingLabels[issueType]; !ok {
-		_, err := createLabel(gl, id, issueType, jiraIssue.Fields.Type.Description, isGroup)
-		if err != nil {
-			return nil, errors.Wrap(err, fmt.Sprintf("Error creating Issue Type label with %s", issueType))
-		}
+	if mapping, ok := cfg.GetIssueTypeMapping(jiraIssue.Fields.Type.Name); !ok || mapping.Label == nil || *mapping.Label {
+		issueType := fmt.Sprintf("type::%s", jiraIssue.Fields.Type.Name)
+		specs = append(specs, labelSpec{issueType, jiraIssue.Fields.Type.Description})
 	}
-	labels = append(labels, issueType)
 
 	//* Component
 	for _, jiraComponent := range jiraIssue.Fields.Components {
 		name := fmt.Sprintf("component:%s", jiraComponent.Name)
-		if _, ok := existingLabels[name]; !ok {
-			_, err := createLabel(gl, id, name, jiraComponent.Description, isGroup)
-			if err != nil {
-				return nil, errors.Wrap(err, fmt.Sprintf("Error creating Component label with %s", name))
-			}
-		}
-		labels = append(labels, name)
+		specs = append(specs, labelSpec{name, jiraComponent.Description})
 	}
 
 	//* Status
 	status := fmt.Sprintf("status::%s", jiraIssue.Fields.Status.Name)
-	if _, ok := existingLabels[status]; !ok {
-		_, err := createLabel(gl, id, status, jiraIssue.Fields.Status.Description, isGroup)
-		if err != nil {
-			return nil, errors.Wrap(err, fmt.Sprintf("Error creating Status label with %s", status))
-		}
+	if mapping, ok := cfg.GetStatusMapping(jiraIssue.Fields.Status.Name); ok && mapping.Label != nil {
+		status = *mapping.Label
+	}
+	if status != "" {
+		specs = append(specs, labelSpec{status, jiraIssue.Fields.Status.Description})
 	}
-	labels = append(labels, status)
 
 	//* Priority
 	priority := fmt.Sprintf("priority::%s", jiraIssue.Fields.Priority.Name)
-	if _, ok := existingLabels[priority]; !ok {
-		_, err := createLabel(gl, id, priority, jiraIssue.Fields.Priority.Description, isGroup)
-		if err != nil {
-			return nil, errors.Wrap(err, fmt.Sprintf("Error creating Priority label with %s", priority))
+	specs = append(specs, labelSpec{priority, jiraIssue.Fields.Priority.Description})
+
+	for _, spec := range specs {
+		labels = append(labels, spec.name)
+	}
+
+	return labels, specs
+}
+
+func convertJiraToGitLabLabels(gl *gitlab.Client, store *state.Store, id interface{}, jiraIssue *jira.Issue, existingLabels map[string]string, isGroup bool) (*gitlab.Labels, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting config")
+	}
+
+	labels, specs := jiraIssueLabels(cfg, jiraIssue)
+
+	for _, spec := range specs {
+		if _, ok := existingLabels[spec.name]; !ok {
+			_, err := createLabel(gl, store, id, spec.name, spec.description, isGroup)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Error creating label with %s", spec.name))
+			}
 		}
 	}
-	labels = append(labels, priority)
 
 	return (*gitlab.Labels)(&labels), nil
 }
 
-func createLabel(gl *gitlab.Client, id interface{}, name string, description string, isGroup bool) (*gitlab.Label, error) {
+// createLabel creates the label and records it, unless it already exists
+func createLabel(gl *gitlab.Client, store *state.Store, id interface{}, name string, description string, isGroup bool) (*gitlab.Label, error) {
 	var label *gitlab.Label
 	var groupLabel *gitlab.GroupLabel
 	var r *gitlab.Response
@@ -94,7 +110,32 @@ func createLabel(gl *gitlab.Client, id interface{}, name string, description str
 		return nil, errors.Wrap(err, fmt.Sprintf("Error creating label with %s", name))
 	} else {
 		log.Infof("Created label: %s", label.Name)
+
+		kind := state.KindLabel
+		if isGroup {
+			kind = state.KindGroupLabel
+		}
+		err := store.Put(&state.Entry{
+			Kind:   kind,
+			Key:    label.Name,
+			ID:     label.ID,
+			Parent: fmt.Sprint(id),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error recording label %s", name))
+		}
 	}
 
 	return label, nil
 }
+
+// isJiraIssueClosed returns whether the GitLab issue or epic should be closed.
+// The state of the status mapping takes precedence over the resolution.
+func isJiraIssueClosed(cfg *config.Config, jiraIssue *jira.Issue) bool {
+	if jiraIssue.Fields.Status != nil {
+		if mapping, ok := cfg.GetStatusMapping(jiraIssue.Fields.Status.Name); ok && mapping.State != "" {
+			return mapping.State == "closed"
+		}
+	}
+	return jiraIssue.Fields.Resolution != nil
+}
@@ -13,6 +13,8 @@ package j2g
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	"github.com/pkg/errors"
@@ -20,6 +22,7 @@ import (
 	gitlab "github.com/xanzy/go-gitlab"
 	"gitlab.com/infograb-public/j2lab/internal/config"
 	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"gitlab.com/infograb-public/j2lab/internal/state"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -33,23 +36,107 @@ type JiraEpicLink struct {
 	gitlabEpic *gitlab.Epic
 }
 
-func convertLinkType(linkType string) (*string, error) {
-	linkTypeMap := map[string]string{
-		// Jira issue type -> GitLab issue/epic type
-		"Blocks":    "blocks",
-		"Cloners":   "relates_to",
-		"Duplicate": "relates_to",
-		"Relates":   "relates_to",
+// defaultLinkTypes are the GitLab link types of the Jira built-in link types, read from the outward issue.
+var defaultLinkTypes = map[string]string{
+	"Blocks":    "blocks",
+	"Cloners":   "relates_to",
+	"Duplicate": "relates_to",
+	"Relates":   "relates_to",
+}
+
+// convertLinkType returns the GitLab link type of the Jira link type, link_type_map first.
+// Unmapped link types are relates_to, ok is false for them.
+func convertLinkType(cfg *config.Config, linkType string) (string, bool) {
+	if mapping, ok := cfg.GetLinkTypeMapping(linkType); ok {
+		return mapping.Type, true
 	}
 
-	if convertedLinkType, ok := linkTypeMap[linkType]; ok {
-		return &convertedLinkType, nil
-	} else {
-		return nil, errors.New(fmt.Sprintf("Unknown link type: %s", linkType))
+	for name, gitlabLinkType := range defaultLinkTypes {
+		if strings.EqualFold(name, linkType) {
+			return gitlabLinkType, true
+		}
 	}
+	return "relates_to", false
 }
 
-func Link(gl *gitlab.Client, jr *jira.Client, epicLinks map[string]*JiraEpicLink, issueLinks map[string]*JiraIssueLink) error {
+// jiraLink is a Jira issue link read from its outward issue, e.g. From blocks To.
+type jiraLink struct {
+	From     string
+	To       string
+	LinkType string //* Jira link type name
+}
+
+// collectJiraLinks returns the links between the issues for which linked is true.
+// A Jira link is found on both of its issues, as outward on one and inward on the other,
+// and GitLab links two issues only once, so each pair of issues is returned once.
+func collectJiraLinks(jiraIssues []*jira.Issue, linked func(key string) bool) []jiraLink {
+	sorted := append([]*jira.Issue{}, jiraIssues...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Key < sorted[j].Key
+	})
+
+	result := []jiraLink{}
+	exist := make(map[string]bool)
+	for _, jiraIssue := range sorted {
+		if jiraIssue.Fields == nil {
+			continue
+		}
+
+		for _, issueLink := range jiraIssue.Fields.IssueLinks {
+			var link jiraLink
+			if issueLink.OutwardIssue != nil {
+				link = jiraLink{jiraIssue.Key, issueLink.OutwardIssue.Key, issueLink.Type.Name}
+			} else if issueLink.InwardIssue != nil {
+				link = jiraLink{issueLink.InwardIssue.Key, jiraIssue.Key, issueLink.Type.Name}
+			} else {
+				continue
+			}
+
+			if link.From == link.To || !linked(link.From) || !linked(link.To) {
+				continue
+			}
+
+			pair := link.From + " " + link.To
+			if link.To < link.From {
+				pair = link.To + " " + link.From
+			}
+			if exist[pair] {
+				continue
+			}
+			exist[pair] = true
+			result = append(result, link)
+		}
+	}
+	return result
+}
+
+// jiraParentKey returns the key of the parent epic or issue, empty if none
+func jiraParentKey(cfg *config.Config, jiraIssue *jira.Issue) string {
+	parentKey := ""
+
+	if cfg.Jira.CustomField.ParentEpic != "" {
+		if parentEpic, ok := jiraIssue.Fields.Unknowns[cfg.Jira.CustomField.ParentEpic]; ok {
+			if parentEpic != nil {
+				parentKey = parentEpic.(string)
+			}
+		}
+	}
+
+	if jiraIssue.Fields.Parent != nil {
+		parentKey = jiraIssue.Fields.Parent.Key
+	}
+
+	return parentKey
+}
+
+func isTask(issue *gitlab.Issue) bool {
+	return issue.IssueType != nil && *issue.IssueType == "task"
+}
+
+// Link creates the parent, issue and epic links of the converted epics and issues. The target epics and issues,
+// e.g. the ones not updated by a sync, are only linked to. The epics and issues are recorded in the registry,
+// so links to other Jira projects are created by the run of whichever project is migrated last.
+func Link(gl *gitlab.Client, registry *state.Store, epicLinks map[string]*JiraEpicLink, issueLinks map[string]*JiraIssueLink, targetEpics map[string]*gitlab.Epic, targetIssues map[string]*gitlab.Issue) error {
 	var g errgroup.Group
 	g.SetLimit(5)
 
@@ -58,52 +145,65 @@ func Link(gl *gitlab.Client, jr *jira.Client, epicLinks map[string]*JiraEpicLink
 		return errors.Wrap(err, "Error getting config")
 	}
 
+	gitlabEpic := func(key string) (*gitlab.Epic, bool) {
+		if epicLink, ok := epicLinks[key]; ok {
+			return epicLink.gitlabEpic, true
+		}
+		epic, ok := targetEpics[key]
+		return epic, ok
+	}
+	gitlabIssue := func(key string) (*gitlab.Issue, bool) {
+		if issueLink, ok := issueLinks[key]; ok {
+			return issueLink.gitlabIssue, true
+		}
+		issue, ok := targetIssues[key]
+		return issue, ok
+	}
+
 	//* Find the parent Issues or Epics
 	for _, jiraIssue := range issueLinks {
 		pid := fmt.Sprintf("%d", jiraIssue.gitlabIssue.ProjectID)
 
 		// Jira는 Epic의 부모 Epic이 없고, GitLab은 Epic이 다른 Epic의 부모가 될 수 있다.
-		parentKey := ""
-
-		if cfg.Jira.CustomField.ParentEpic != "" {
-			if parentEpic, ok := jiraIssue.Fields.Unknowns[cfg.Jira.CustomField.ParentEpic]; ok {
-				if parentEpic != nil {
-					parentKey = parentEpic.(string)
-				}
-			}
-		}
-
-		if jiraIssue.Fields.Parent != nil {
-			parentKey = jiraIssue.Fields.Parent.Key
-		}
+		parentKey := jiraParentKey(cfg, jiraIssue.Issue)
 
 		if parentKey != "" {
 			g.Go(func(jiraIssue *JiraIssueLink, parentKey string) func() error {
 				return func() error {
 					//* If this Issue has a parent Epic
-					if parentEpicLink, ok := epicLinks[parentKey]; ok {
+					if parentEpic, ok := gitlabEpic(parentKey); ok {
 						_, _, err := gl.Issues.UpdateIssue(pid, jiraIssue.gitlabIssue.IID, &gitlab.UpdateIssueOptions{
-							EpicID: &parentEpicLink.gitlabEpic.ID,
+							EpicID: &parentEpic.ID,
 						})
 						if err != nil {
 							return errors.Wrap(err, fmt.Sprintf("Error linking GitLab issue %s with its parent epic %s", jiraIssue.Key, parentKey))
 						}
-						log.Infof("Linked issue %s(%d) to parent epic %s(%d)", jiraIssue.Key, jiraIssue.gitlabIssue.IID, parentKey, parentEpicLink.gitlabEpic.IID)
+						log.Infof("Linked issue %s(%d) to parent epic %s(%d)", jiraIssue.Key, jiraIssue.gitlabIssue.IID, parentKey, parentEpic.IID)
 					}
 
 					//* If this Issue has a parent Issue (Subtask)
-					if parentIssueLink, ok := issueLinks[parentKey]; ok {
-						parentIssueIID := fmt.Sprintf("%d", parentIssueLink.gitlabIssue.IID)
-						_, _, err := gl.IssueLinks.CreateIssueLink(pid, jiraIssue.gitlabIssue.IID, &gitlab.CreateIssueLinkOptions{
+					if parentIssue, ok := gitlabIssue(parentKey); ok && isTask(jiraIssue.gitlabIssue) {
+						//* Tasks become child tasks of the parent issue
+						_, err := gitlabx.SetWorkItemParent(gl, jiraIssue.gitlabIssue.ID, parentIssue.ID)
+						if err != nil {
+							return errors.Wrap(err, fmt.Sprintf("Error setting GitLab issue %s as child task of its parent issue %s", jiraIssue.Key, parentKey))
+						}
+						log.Infof("Set issue %s(%d) as child task of parent issue %s(%d)", jiraIssue.Key, jiraIssue.gitlabIssue.IID, parentKey, parentIssue.IID)
+					} else if ok {
+						parentIssueIID := fmt.Sprintf("%d", parentIssue.IID)
+						_, r, err := gl.IssueLinks.CreateIssueLink(pid, jiraIssue.gitlabIssue.IID, &gitlab.CreateIssueLinkOptions{
 							// IID: &issueLinks[innerIssueLink.OutwardIssue.Key].gitlabIssue.IID,
 							TargetProjectID: gitlab.String(pid),
 							TargetIssueIID:  gitlab.String(parentIssueIID),
 							LinkType:        gitlab.String("blocks"),
 						})
-						if err != nil {
+						if r != nil && r.StatusCode == 409 {
+							log.Debugf("Issue %s is already linked to parent issue %s", jiraIssue.Key, parentKey)
+							return nil
+						} else if err != nil {
 							return errors.Wrap(err, fmt.Sprintf("Error linking GitLab issue %s with its parent issue %s", jiraIssue.Key, parentKey))
 						}
-						log.Infof("Linked issue %s(%d) to parent issue %s(%d)", jiraIssue.Key, jiraIssue.gitlabIssue.IID, parentKey, parentIssueLink.gitlabIssue.IID)
+						log.Infof("Linked issue %s(%d) to parent issue %s(%d)", jiraIssue.Key, jiraIssue.gitlabIssue.IID, parentKey, parentIssue.IID)
 					}
 					return nil
 				}
@@ -115,45 +215,32 @@ func Link(gl *gitlab.Client, jr *jira.Client, epicLinks map[string]*JiraEpicLink
 		return errors.Wrap(err, "Error Link issue with its parent")
 	}
 
+	//* Unmapped link types are linked as relates_to
+	warned := make(map[string]bool)
+	linkType := func(link jiraLink) *string {
+		gitlabLinkType, ok := convertLinkType(cfg, link.LinkType)
+		if !ok && !warned[link.LinkType] {
+			warned[link.LinkType] = true
+			log.Warnf("Unknown link type %s, linking as relates_to. Map it in link_type_map of config.yaml", link.LinkType)
+		}
+		return &gitlabLinkType
+	}
+
 	//* Link Issue with other issues
+	jiraIssues := []*jira.Issue{}
 	for _, jiraIssue := range issueLinks {
-		pid := fmt.Sprintf("%d", jiraIssue.gitlabIssue.ProjectID)
-
-		if jiraIssue.Fields.IssueLinks != nil {
-			for _, innerIssueLink := range jiraIssue.Fields.IssueLinks {
-				outwardIssue := innerIssueLink.OutwardIssue
-				outwardType := innerIssueLink.Type.Name
-				if outwardIssue == nil || outwardIssue.Fields.Type.Name == "Epic" {
-					continue
-				}
+		jiraIssues = append(jiraIssues, jiraIssue.Issue)
+	}
 
-				if outwardIssue != nil {
-					if _, ok := issueLinks[outwardIssue.Key]; ok {
-						g.Go(func(jiraIssue *JiraIssueLink) func() error {
-							return func() error {
-								targetIssueIID := fmt.Sprintf("%d", issueLinks[outwardIssue.Key].gitlabIssue.IID)
-								linkType, err := convertLinkType(outwardType)
-								if err != nil {
-									return errors.Wrap(err, fmt.Sprintf("Error Converting link type: %s", outwardType))
-								}
-
-								_, _, err = gl.IssueLinks.CreateIssueLink(pid, jiraIssue.gitlabIssue.IID, &gitlab.CreateIssueLinkOptions{
-									TargetProjectID: &pid,
-									TargetIssueIID:  &targetIssueIID,
-									LinkType:        linkType,
-								})
-								if err != nil {
-									return errors.Wrap(err, fmt.Sprintf("Error Creating Issue link from %s to %s", jiraIssue.Key, outwardIssue.Key))
-								}
-
-								log.Infof("Linked issue %s(%d) to %s(%d) with link type %s", jiraIssue.Key, jiraIssue.gitlabIssue.IID, outwardIssue.Key, issueLinks[outwardIssue.Key].gitlabIssue.IID, outwardType)
-								return nil
-							}
-						}(jiraIssue))
-					}
-				}
+	for _, link := range collectJiraLinks(jiraIssues, func(key string) bool { _, ok := gitlabIssue(key); return ok }) {
+		from, _ := gitlabIssue(link.From)
+		to, _ := gitlabIssue(link.To)
+		g.Go(func(link jiraLink, from gitlabRef, to gitlabRef, gitlabLinkType *string) func() error {
+			return func() error {
+				_, err := createGitLabLink(gl, link, from, to, gitlabLinkType)
+				return err
 			}
-		}
+		}(link, issueRef(from), issueRef(to), linkType(link)))
 	}
 
 	if err := g.Wait(); err != nil {
@@ -161,52 +248,203 @@ func Link(gl *gitlab.Client, jr *jira.Client, epicLinks map[string]*JiraEpicLink
 	}
 
 	//* Link Epic with other epics
-	for _, jiraIssue := range epicLinks {
-		gid := fmt.Sprintf("%d", jiraIssue.gitlabEpic.GroupID)
+	// GitLab Epic은 GitLab Epic 끼리만 연결할 수 있다.
+	jiraEpics := []*jira.Issue{}
+	for _, jiraEpic := range epicLinks {
+		jiraEpics = append(jiraEpics, jiraEpic.Issue)
+	}
 
-		if jiraIssue.Fields.IssueLinks != nil {
-			for _, innerIssueLink := range jiraIssue.Fields.IssueLinks {
-				outwardIssue := innerIssueLink.OutwardIssue
-				outwardType := innerIssueLink.Type.Name
+	for _, link := range collectJiraLinks(jiraEpics, func(key string) bool { _, ok := gitlabEpic(key); return ok }) {
+		from, _ := gitlabEpic(link.From)
+		to, _ := gitlabEpic(link.To)
+		g.Go(func(link jiraLink, from gitlabRef, to gitlabRef, gitlabLinkType *string) func() error {
+			return func() error {
+				_, err := createGitLabLink(gl, link, from, to, gitlabLinkType)
+				return err
+			}
+		}(link, epicRef(from), epicRef(to), linkType(link)))
+	}
 
-				// GitLab Epic은 GitLab Epic 끼리만 연결할 수 있다.
-				if outwardIssue == nil || outwardIssue.Fields.Type.Name == "Issue" {
-					continue
-				}
+	if err := g.Wait(); err != nil {
+		return errors.Wrap(err, "Error Link epic with other epic")
+	}
 
-				if outwardIssue != nil {
-					if _, ok := issueLinks[outwardIssue.Key]; ok {
-						if _, ok := epicLinks[outwardIssue.Key]; ok {
-							g.Go(func(jiraIssue *JiraEpicLink) func() error {
-								return func() error {
-									targetEpicIID := fmt.Sprintf("%d", epicLinks[outwardIssue.Key].gitlabEpic.IID)
-									linkType, err := convertLinkType(outwardType)
-									if err != nil {
-										return errors.Wrap(err, "Error creating GitLab epic link")
-									}
-									_, _, err = gitlabx.CreateEpicLink(gl, gid, jiraIssue.gitlabEpic.IID, &gitlabx.CreateEpicLinkOptions{
-										TargetGroupID: &gid,
-										TargetEpicIID: &targetEpicIID,
-										LinkType:      linkType,
-									})
-									if err != nil {
-										return errors.Wrap(err, "Error creating GitLab epic link")
-									}
-
-									log.Infof("Linked epic %s(%d) to %s(%d) with link type %s", jiraIssue.Key, jiraIssue.gitlabEpic.IID, outwardIssue.Key, epicLinks[outwardIssue.Key].gitlabEpic.IID, outwardType)
-									return nil
-								}
-							}(jiraIssue))
-						}
-					}
+	//* Link with the epics and issues of other runs, e.g. other Jira projects
+	if err := registerGitLabLinks(registry, epicLinks, issueLinks); err != nil {
+		return errors.Wrap(err, "Error registering epics and issues")
+	}
+
+	local := func(key string) bool {
+		_, isEpic := gitlabEpic(key)
+		_, isIssue := gitlabIssue(key)
+		return isEpic || isIssue
+	}
+	for _, link := range collectJiraLinks(append(jiraEpics, jiraIssues...), func(key string) bool { return true }) {
+		if local(link.From) && local(link.To) {
+			continue
+		}
+		if err := queueLink(registry, link); err != nil {
+			return errors.Wrap(err, "Error queueing cross-project link")
+		}
+	}
+
+	for _, entry := range registry.Entries(state.KindLink) {
+		fromKey, toKey, _ := strings.Cut(entry.Key, " ")
+		link := jiraLink{fromKey, toKey, entry.LinkType}
+		from, fromOk := lookupGitLabRef(registry, link.From)
+		to, toOk := lookupGitLabRef(registry, link.To)
+		if !fromOk || !toOk {
+			log.Debugf("Keeping link from %s to %s queued until both are migrated", link.From, link.To)
+			continue
+		}
+		//* The link is created again when either end was migrated again, e.g. after a rollback
+		if _, ok := registry.Get(state.KindLinked, linkedKey(from, to)); ok {
+			continue
+		}
+		if from.Epic != to.Epic {
+			log.Warnf("Skipping link from %s to %s, GitLab does not link epics with issues", link.From, link.To)
+			continue
+		}
+
+		g.Go(func(link jiraLink, from gitlabRef, to gitlabRef, gitlabLinkType *string) func() error {
+			return func() error {
+				//* A link to a deleted epic or issue stays queued, it is created when the project is migrated again
+				linked, err := createGitLabLink(gl, link, from, to, gitlabLinkType)
+				if err != nil || !linked {
+					return err
 				}
+				return registry.Put(&state.Entry{
+					Kind: state.KindLinked,
+					Key:  linkedKey(from, to),
+				})
 			}
-		}
+		}(link, from, to, linkType(link)))
 	}
 
 	if err := g.Wait(); err != nil {
-		return errors.Wrap(err, "Error Link epic with other epic")
+		return errors.Wrap(err, "Error Link with other projects")
+	}
+
+	return nil
+}
+
+// gitlabRef is an epic or issue by its group or project ID.
+type gitlabRef struct {
+	Parent string
+	ID     int
+	IID    int
+	Epic   bool
+}
+
+// String returns the reference of the epic or issue, e.g. 10#1 for an issue or 20&3 for an epic
+func (r gitlabRef) String() string {
+	if r.Epic {
+		return fmt.Sprintf("%s&%d", r.Parent, r.IID)
+	}
+	return fmt.Sprintf("%s#%d", r.Parent, r.IID)
+}
+
+// linkedKey is the key of a created link, by the GitLab epics or issues it links
+func linkedKey(from gitlabRef, to gitlabRef) string {
+	return from.String() + " " + to.String()
+}
+
+func issueRef(issue *gitlab.Issue) gitlabRef {
+	return gitlabRef{fmt.Sprint(issue.ProjectID), issue.ID, issue.IID, false}
+}
+
+func epicRef(epic *gitlab.Epic) gitlabRef {
+	return gitlabRef{fmt.Sprint(epic.GroupID), epic.ID, epic.IID, true}
+}
+
+// createGitLabLink links two epics or two issues, possibly of different projects or groups.
+// Existing links are skipped, linked is false if one of them was deleted since it was registered.
+func createGitLabLink(gl *gitlab.Client, link jiraLink, from gitlabRef, to gitlabRef, linkType *string) (bool, error) {
+	targetIID := fmt.Sprint(to.IID)
+
+	var r *gitlab.Response
+	var err error
+	if from.Epic {
+		_, r, err = gitlabx.CreateEpicLink(gl, from.Parent, from.IID, &gitlabx.CreateEpicLinkOptions{
+			TargetGroupID: &to.Parent,
+			TargetEpicIID: &targetIID,
+			LinkType:      linkType,
+		})
+	} else {
+		_, r, err = gl.IssueLinks.CreateIssueLink(from.Parent, from.IID, &gitlab.CreateIssueLinkOptions{
+			TargetProjectID: &to.Parent,
+			TargetIssueIID:  &targetIID,
+			LinkType:        linkType,
+		})
+	}
+
+	if r != nil && r.StatusCode == 409 {
+		log.Debugf("%s is already linked to %s", link.From, link.To)
+		return true, nil
+	} else if r != nil && r.StatusCode == 404 {
+		log.Warnf("Skipping link from %s to %s, one of them no longer exists in GitLab", link.From, link.To)
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, fmt.Sprintf("Error Creating link from %s to %s", link.From, link.To))
+	}
+
+	log.Infof("Linked %s(%d) to %s(%d) with link type %s", link.From, from.IID, link.To, to.IID, link.LinkType)
+	return true, nil
+}
+
+// registerGitLabLinks records the epics and issues of the run in the registry shared by the runs of every Jira project.
+func registerGitLabLinks(registry *state.Store, epicLinks map[string]*JiraEpicLink, issueLinks map[string]*JiraIssueLink) error {
+	refs := make(map[string]gitlabRef)
+	for key, epicLink := range epicLinks {
+		refs[key] = epicRef(epicLink.gitlabEpic)
+	}
+	for key, issueLink := range issueLinks {
+		refs[key] = issueRef(issueLink.gitlabIssue)
 	}
 
+	for key, ref := range refs {
+		kind := state.KindIssue
+		if ref.Epic {
+			kind = state.KindEpic
+		}
+
+		if entry, ok := registry.Get(kind, key); ok && entry.Parent == ref.Parent && entry.IID == ref.IID {
+			continue
+		}
+		err := registry.Put(&state.Entry{
+			Kind:   kind,
+			Key:    key,
+			ID:     ref.ID,
+			IID:    ref.IID,
+			Parent: ref.Parent,
+		})
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error registering %s", key))
+		}
+	}
 	return nil
 }
+
+// lookupGitLabRef returns the epic or issue registered for the Jira key.
+func lookupGitLabRef(registry *state.Store, key string) (gitlabRef, bool) {
+	if entry, ok := registry.Get(state.KindIssue, key); ok {
+		return gitlabRef{entry.Parent, entry.ID, entry.IID, false}, true
+	}
+	if entry, ok := registry.Get(state.KindEpic, key); ok {
+		return gitlabRef{entry.Parent, entry.ID, entry.IID, true}, true
+	}
+	return gitlabRef{}, false
+}
+
+// queueLink records the link in the registry, it is created once both of its ends are registered.
+func queueLink(registry *state.Store, link jiraLink) error {
+	key := link.From + " " + link.To
+	if _, ok := registry.Get(state.KindLink, key); ok {
+		return nil
+	}
+	return registry.Put(&state.Entry{
+		Kind:     state.KindLink,
+		Key:      key,
+		LinkType: link.LinkType,
+	})
+}
@@ -0,0 +1,146 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/state"
+)
+
+func TestConvertLinkType(t *testing.T) {
+	cfg := &config.Config{
+		LinkTypeMap: map[string]config.LinkTypeMapping{
+			"cloners":       {Type: "blocks"},
+			"test coverage": {Type: "is_blocked_by"},
+		},
+	}
+
+	tests := []struct {
+		linkType string
+		want     string
+		wantOk   bool
+	}{
+		{"Blocks", "blocks", true},
+		{"Relates", "relates_to", true},
+		{"Cloners", "blocks", true},
+		{"Test Coverage", "is_blocked_by", true},
+		{"Problem/Incident", "relates_to", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.linkType, func(t *testing.T) {
+			got, ok := convertLinkType(cfg, tt.linkType)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("convertLinkType() = %s, %t, want %s, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestCollectJiraLinks(t *testing.T) {
+	link := func(linkType string, outward string, inward string) *jira.IssueLink {
+		issueLink := &jira.IssueLink{Type: jira.IssueLinkType{Name: linkType}}
+		if outward != "" {
+			issueLink.OutwardIssue = &jira.Issue{Key: outward}
+		}
+		if inward != "" {
+			issueLink.InwardIssue = &jira.Issue{Key: inward}
+		}
+		return issueLink
+	}
+	issue := func(key string, links ...*jira.IssueLink) *jira.Issue {
+		return &jira.Issue{Key: key, Fields: &jira.IssueFields{IssueLinks: links}}
+	}
+
+	jiraIssues := []*jira.Issue{
+		//* SSP-2 is blocked by SSP-1, read from both issues
+		issue("SSP-2", link("Blocks", "", "SSP-1"), link("Relates", "SSP-3", "")),
+		issue("SSP-1", link("Blocks", "SSP-2", "")),
+		//* SSP-3 relates to SSP-2 again, the other way
+		issue("SSP-3", link("Relates", "SSP-2", ""), link("Relates", "OTHER-1", "")),
+	}
+
+	got := collectJiraLinks(jiraIssues, func(key string) bool { return key != "OTHER-1" })
+	want := []jiraLink{
+		{"SSP-1", "SSP-2", "Blocks"},
+		{"SSP-2", "SSP-3", "Relates"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectJiraLinks() = %v, want %v", got, want)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "j2lab.registry.jsonl")
+	registry, err := state.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//* The run of SSP links SSP-1 to ABC-1, which is not migrated yet
+	err = registerGitLabLinks(registry, map[string]*JiraEpicLink{}, map[string]*JiraIssueLink{
+		"SSP-1": {&jira.Issue{Key: "SSP-1"}, &gitlab.Issue{ID: 101, IID: 1, ProjectID: 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := queueLink(registry, jiraLink{"SSP-1", "ABC-1", "Blocks"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := lookupGitLabRef(registry, "ABC-1"); ok {
+		t.Errorf("lookupGitLabRef() found ABC-1 before its run")
+	}
+	registry.Close()
+
+	//* The run of ABC reads the queue of the previous run
+	registry, err = state.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer registry.Close()
+
+	err = registerGitLabLinks(registry, map[string]*JiraEpicLink{
+		"ABC-1": {&jira.Issue{Key: "ABC-1"}, &gitlab.Epic{ID: 201, IID: 3, GroupID: 20}},
+	}, map[string]*JiraIssueLink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := registry.Entries(state.KindLink)
+	if len(queued) != 1 || queued[0].Key != "SSP-1 ABC-1" || queued[0].LinkType != "Blocks" {
+		t.Errorf("Entries() = %v, want the link SSP-1 ABC-1 queued once", queued)
+	}
+
+	from, ok := lookupGitLabRef(registry, "SSP-1")
+	if want := (gitlabRef{"10", 101, 1, false}); !ok || from != want {
+		t.Errorf("lookupGitLabRef() = %v, %t, want %v, true", from, ok, want)
+	}
+	to, ok := lookupGitLabRef(registry, "ABC-1")
+	if want := (gitlabRef{"20", 201, 3, true}); !ok || to != want {
+		t.Errorf("lookupGitLabRef() = %v, %t, want %v, true", to, ok, want)
+	}
+
+	//* A link created before a rollback does not hide the link of the epic migrated again
+	if got, want := linkedKey(from, to), "10#1 20&3"; got != want {
+		t.Errorf("linkedKey() = %s, want %s", got, want)
+	}
+	if linkedKey(from, gitlabRef{"20", 202, 4, true}) == linkedKey(from, to) {
+		t.Errorf("linkedKey() is the same for another epic")
+	}
+}
@@ -25,7 +25,7 @@ type Milestone struct {
 	JiraVersion *jira.Version
 }
 
-func createMilestoneFromJiraVersion(jr *jira.Client, gl *gitlab.Client, pid interface{}, jiraVersion *jira.Version) (*Milestone, error) {
+func createMilestoneFromJiraVersion(gl *gitlab.Client, pid interface{}, jiraVersion *jira.Version) (*Milestone, error) {
 	log.Infof("Creating milestone: %s", jiraVersion.Name)
 
 	var startDate time.Time
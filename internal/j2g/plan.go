@@ -0,0 +1,247 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+)
+
+// Plan is what ConvertByProject is going to do, computed with read-only calls only.
+type Plan struct {
+	JiraProject   string `json:"jira_project"`
+	GitLabProject string `json:"gitlab_project"`
+	GitLabGroup   string `json:"gitlab_group"`
+
+	Epics         PlanItems `json:"epics"`
+	Issues        PlanItems `json:"issues"`
+	Milestones    PlanItems `json:"milestones"`
+	GroupLabels   PlanItems `json:"group_labels"`
+	ProjectLabels PlanItems `json:"project_labels"`
+
+	MissingUsers                []string        `json:"missing_users"`
+	NonMemberUsers              []string        `json:"non_member_users"`
+	FixVersionsWithoutMilestone []PlanIssueItem `json:"fix_versions_without_milestone"`
+	UnmappedLinkTypes           []PlanIssueItem `json:"unmapped_link_types"`
+}
+
+type PlanItems struct {
+	Create    []string `json:"create"`
+	Update    []string `json:"update"`
+	Unchanged []string `json:"unchanged,omitempty"`
+}
+
+type PlanIssueItem struct {
+	Issue string `json:"issue"`
+	Value string `json:"value"`
+}
+
+func (p *Plan) HasProblems() bool {
+	return len(p.MissingUsers) > 0 || len(p.NonMemberUsers) > 0 || len(p.FixVersionsWithoutMilestone) > 0 || len(p.UnmappedLinkTypes) > 0
+}
+
+func NewPlan(gl *gitlab.Client, jr *jira.Client) (*Plan, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting config")
+	}
+
+	plan := &Plan{
+		JiraProject:   cfg.Jira.Name,
+		GitLabProject: cfg.GitLab.Issue,
+		GitLabGroup:   cfg.GitLab.Epic,
+	}
+
+	//* Jira
+	jiraProject, _, err := jr.Project.Get(context.Background(), cfg.Jira.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting Jira project: %s", cfg.Jira.Name))
+	}
+
+	jiraEpics, jiraIssues, err := GetJiraIssues(jr, cfg, cfg.Jira.Jql)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting Jira issues: %s", cfg.Jira.Name))
+	}
+
+	//* GitLab
+	gitlabProject, _, err := gl.Projects.GetProject(cfg.GitLab.Issue, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting GitLab project: %s", cfg.GitLab.Issue))
+	}
+
+	existingMilestones, err := gitlabx.Unpaginate[gitlab.Milestone](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Milestone, *gitlab.Response, error) {
+		return gl.Milestones.ListMilestones(gitlabProject.ID, &gitlab.ListMilestonesOptions{ListOptions: *opt})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting GitLab milestones from GitLab")
+	}
+
+	existingGroupLabels, existingProjectLabels, err := getExistingLabels(gl, cfg.GitLab.Epic, gitlabProject.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting GitLab labels")
+	}
+
+	importedEpics, err := findImportedEpics(gl, cfg.GitLab.Epic)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error finding GitLab epics imported by a previous run")
+	}
+
+	importedIssues, err := findImportedIssues(gl, gitlabProject.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error finding GitLab issues imported by a previous run")
+	}
+
+	//* Milestones
+	milestones := make(map[string]bool)
+	for _, milestone := range existingMilestones {
+		milestones[milestone.Title] = true
+	}
+	for _, version := range jiraProject.Versions {
+		//* A run never updates existing milestones
+		if milestones[version.Name] {
+			plan.Milestones.Unchanged = append(plan.Milestones.Unchanged, version.Name)
+		} else {
+			plan.Milestones.Create = append(plan.Milestones.Create, version.Name)
+			milestones[version.Name] = true
+		}
+	}
+
+	//* Epics and Issues
+	groupLabels := make(map[string]bool)
+	for _, epic := range jiraEpics {
+		if _, ok := importedEpics[epic.Key]; ok {
+			plan.Epics.Update = append(plan.Epics.Update, epic.Key)
+		} else {
+			plan.Epics.Create = append(plan.Epics.Create, epic.Key)
+		}
+
+		_, specs := jiraIssueLabels(cfg, epic)
+		for _, spec := range specs {
+			if _, ok := existingGroupLabels[spec.name]; !ok && !groupLabels[spec.name] {
+				groupLabels[spec.name] = true
+				plan.GroupLabels.Create = append(plan.GroupLabels.Create, spec.name)
+			}
+		}
+	}
+
+	projectLabels := make(map[string]bool)
+	for _, issue := range jiraIssues {
+		if _, ok := importedIssues[issue.Key]; ok {
+			plan.Issues.Update = append(plan.Issues.Update, issue.Key)
+		} else {
+			plan.Issues.Create = append(plan.Issues.Create, issue.Key)
+		}
+
+		_, specs := jiraIssueLabels(cfg, issue)
+		for _, spec := range specs {
+			if _, ok := existingProjectLabels[spec.name]; !ok && !projectLabels[spec.name] {
+				projectLabels[spec.name] = true
+				plan.ProjectLabels.Create = append(plan.ProjectLabels.Create, spec.name)
+			}
+		}
+
+		if len(issue.Fields.FixVersions) > 0 && !milestones[issue.Fields.FixVersions[0].Name] {
+			plan.FixVersionsWithoutMilestone = append(plan.FixVersionsWithoutMilestone, PlanIssueItem{issue.Key, issue.Fields.FixVersions[0].Name})
+		}
+	}
+
+	//* Users
+	usernames, err := GetJiraUsernamesFromIssues(cfg, append(jiraEpics, jiraIssues...))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting Jira users from issues")
+	}
+	members, err := getProjectMemberIDs(gl, gitlabProject.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting GitLab project members: %s", cfg.GitLab.Issue))
+	}
+	for _, username := range usernames {
+		gitlabID, ok := cfg.Users[username]
+		if !ok {
+			plan.MissingUsers = append(plan.MissingUsers, username)
+		} else if !members[gitlabID] {
+			//* The run fails on the users who are not members of the project
+			plan.NonMemberUsers = append(plan.NonMemberUsers, fmt.Sprintf("%s (GitLab user %d)", username, gitlabID))
+		}
+	}
+
+	//* Links
+	for _, issue := range append(jiraEpics, jiraIssues...) {
+		for _, issueLink := range issue.Fields.IssueLinks {
+			if _, ok := convertLinkType(cfg, issueLink.Type.Name); !ok {
+				plan.UnmappedLinkTypes = append(plan.UnmappedLinkTypes, PlanIssueItem{issue.Key, issueLink.Type.Name})
+			}
+		}
+	}
+
+	sort.Strings(plan.GroupLabels.Create)
+	sort.Strings(plan.ProjectLabels.Create)
+	sort.Strings(plan.MissingUsers)
+	sort.Strings(plan.NonMemberUsers)
+
+	return plan, nil
+}
+
+func (p *Plan) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Plan: Jira project %s -> GitLab project %s, group %s\n", p.JiraProject, p.GitLabProject, p.GitLabGroup)
+
+	writeItems := func(title string, items PlanItems) {
+		fmt.Fprintf(w, "\n%s: %d to create, %d to update, %d unchanged\n", title, len(items.Create), len(items.Update), len(items.Unchanged))
+		for _, item := range items.Create {
+			fmt.Fprintf(w, "  + %s\n", item)
+		}
+		for _, item := range items.Update {
+			fmt.Fprintf(w, "  ~ %s\n", item)
+		}
+	}
+
+	writeItems("Epics", p.Epics)
+	writeItems("Issues", p.Issues)
+	writeItems("Milestones", p.Milestones)
+	writeItems("Group labels", p.GroupLabels)
+	writeItems("Project labels", p.ProjectLabels)
+
+	if len(p.MissingUsers) > 0 {
+		fmt.Fprintf(w, "\nJira users missing in user.csv: %d\n", len(p.MissingUsers))
+		for _, username := range p.MissingUsers {
+			fmt.Fprintf(w, "  ! %s\n", username)
+		}
+	}
+
+	if len(p.NonMemberUsers) > 0 {
+		fmt.Fprintf(w, "\nMapped users not members of GitLab project %s: %d\n", p.GitLabProject, len(p.NonMemberUsers))
+		for _, username := range p.NonMemberUsers {
+			fmt.Fprintf(w, "  ! %s\n", username)
+		}
+	}
+
+	if len(p.FixVersionsWithoutMilestone) > 0 {
+		fmt.Fprintf(w, "\nFix versions without milestone: %d\n", len(p.FixVersionsWithoutMilestone))
+		for _, item := range p.FixVersionsWithoutMilestone {
+			fmt.Fprintf(w, "  ! %s: %s\n", item.Issue, item.Value)
+		}
+	}
+
+	if len(p.UnmappedLinkTypes) > 0 {
+		fmt.Fprintf(w, "\nUnmapped link types, linked as relates_to: %d\n", len(p.UnmappedLinkTypes))
+		for _, item := range p.UnmappedLinkTypes {
+			fmt.Fprintf(w, "  ! %s: %s\n", item.Issue, item.Value)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/cache"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+	"gitlab.com/infograb-public/j2lab/internal/storage"
+)
+
+// SkippedAttachment is an attachment not uploaded to GitLab, listed in the report at the end of the run.
+type SkippedAttachment struct {
+	IssueKey string
+	Filename string
+	Size     int64
+	Reason   string
+	Action   string
+	URL      string //* Jira or storage URL, empty if skipped
+}
+
+var (
+	skippedAttachments      []*SkippedAttachment
+	skippedAttachmentsMutex sync.Mutex
+
+	attachmentStorage      storage.Storage
+	attachmentStorageMutex sync.Mutex
+)
+
+// SkippedAttachments returns the attachments skipped since the start of the run, sorted by issue.
+func SkippedAttachments() []*SkippedAttachment {
+	skippedAttachmentsMutex.Lock()
+	defer skippedAttachmentsMutex.Unlock()
+
+	result := append([]*SkippedAttachment{}, skippedAttachments...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].IssueKey < result[j].IssueKey
+	})
+	return result
+}
+
+// WriteSkippedAttachments writes the report of the skipped attachments.
+func WriteSkippedAttachments(w io.Writer, skipped []*SkippedAttachment) {
+	fmt.Fprintf(w, "\nSkipped attachments: %d\n", len(skipped))
+	for _, s := range skipped {
+		line := fmt.Sprintf("  - %s %s (%s): %s, %s", s.IssueKey, s.Filename, formatSize(s.Size), s.Reason, s.Action)
+		if s.URL != "" {
+			line += " " + s.URL
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func resetSkippedAttachments() {
+	skippedAttachmentsMutex.Lock()
+	defer skippedAttachmentsMutex.Unlock()
+	skippedAttachments = nil
+}
+
+// convertJiraAttachmentWithPolicy converts the attachment with upload, unless the attachment policy rejects it or GitLab refuses it as too large.
+// A rejected attachment is replaced by a note, a link to Jira or a link to the external storage, and reported.
+func convertJiraAttachmentWithPolicy(cfg *config.Config, src jirax.Source, jiraKey string, attachement *jira.Attachment, upload func() (*Attachment, error)) (*Attachment, error) {
+	size := int64(attachement.Size)
+	maxSize := cfg.Attachment.MaxSizeBytes()
+
+	//* The size is unknown in CSV exports
+	if size == 0 && maxSize > 0 {
+		var err error
+		size, err = getCachedJiraAttachmentSize(src, attachement)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error getting attachment size")
+		}
+	}
+
+	reason := rejectAttachment(&cfg.Attachment, attachement.Filename, attachement.MimeType, size)
+	if reason == "" {
+		attachment, err := upload()
+		if !isTooLarge(err) {
+			return attachment, err
+		}
+		reason = "rejected by GitLab as too large"
+	}
+
+	return convertRejectedJiraAttachment(cfg, src, jiraKey, attachement, size, reason)
+}
+
+// rejectAttachment returns why the policy rejects the attachment, empty if it is uploaded.
+func rejectAttachment(policy *config.AttachmentPolicy, filename string, mimeType string, size int64) string {
+	if maxSize := policy.MaxSizeBytes(); maxSize > 0 && size > maxSize {
+		return fmt.Sprintf("larger than %s", formatSize(maxSize))
+	}
+	if matchAttachment(policy.Deny, filename, mimeType) {
+		return "denied type"
+	}
+	if len(policy.Allow) > 0 && !matchAttachment(policy.Allow, filename, mimeType) {
+		return "type not allowed"
+	}
+	return ""
+}
+
+// matchAttachment matches extensions, e.g. .png or png, and MIME types, e.g. image/png or image/*.
+func matchAttachment(patterns []string, filename string, mimeType string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, mimeType); ok && mimeType != "" {
+				return true
+			}
+		} else if ext != "" && "."+strings.TrimPrefix(pattern, ".") == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func convertRejectedJiraAttachment(cfg *config.Config, src jirax.Source, jiraKey string, attachement *jira.Attachment, size int64, reason string) (*Attachment, error) {
+	action := cfg.Attachment.Action
+	if action == "" {
+		action = "skip"
+	}
+
+	var markdown, link string
+	switch action {
+	case "link":
+		link = jiraAttachmentURL(cfg, attachement)
+		markdown = fmt.Sprintf("[%s](%s)", attachement.Filename, link)
+	case "store":
+		var err error
+		link, err = storeJiraAttachment(cfg, src, attachement)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error storing attachment")
+		}
+		markdown = fmt.Sprintf("[%s](%s)", attachement.Filename, link)
+		if strings.HasPrefix(attachement.MimeType, "image/") {
+			markdown = "!" + markdown
+		}
+	default:
+		markdown = fmt.Sprintf("*%s was not migrated: %s*", attachement.Filename, reason)
+	}
+
+	log.Warnf("Attachment %s of %s not uploaded to GitLab (%s): %s", attachement.Filename, jiraKey, reason, action)
+
+	skippedAttachmentsMutex.Lock()
+	skippedAttachments = append(skippedAttachments, &SkippedAttachment{
+		IssueKey: jiraKey,
+		Filename: attachement.Filename,
+		Size:     size,
+		Reason:   reason,
+		Action:   action,
+		URL:      link,
+	})
+	skippedAttachmentsMutex.Unlock()
+
+	//* The marker tells verify the attachment was handled by the policy
+	return &Attachment{
+		ID:        attachement.ID,
+		Markdown:  markdown + " " + importedRejectedAttachmentMarker(attachement.ID),
+		Filename:  attachement.Filename,
+		CreatedAt: attachement.Created,
+		Alt:       attachement.Filename,
+		URL:       link,
+		Rejected:  true,
+	}, nil
+}
+
+// jiraAttachmentURL returns the content URL of the attachment, which the archives and backups do not always keep.
+func jiraAttachmentURL(cfg *config.Config, attachement *jira.Attachment) string {
+	if attachement.Content != "" {
+		return attachement.Content
+	}
+	return fmt.Sprintf("%s/secure/attachment/%s/%s", strings.TrimSuffix(cfg.Jira.Host, "/"), attachement.ID, url.PathEscape(attachement.Filename))
+}
+
+func storeJiraAttachment(cfg *config.Config, src jirax.Source, attachement *jira.Attachment) (string, error) {
+	attachmentStorageMutex.Lock()
+	if attachmentStorage == nil {
+		s, err := storage.New(&cfg.Attachment.Store)
+		if err != nil {
+			attachmentStorageMutex.Unlock()
+			return "", errors.Wrap(err, "Error opening attachment storage")
+		}
+		attachmentStorage = s
+	}
+	s := attachmentStorage
+	attachmentStorageMutex.Unlock()
+
+	sum, err := getCachedJiraAttachment(src, attachement)
+	if err != nil {
+		return "", errors.Wrap(err, "Error downloading file")
+	}
+
+	c, err := cache.GetCache()
+	if err != nil {
+		return "", errors.Wrap(err, "Error opening attachment cache")
+	}
+
+	return s.Put(storageKey(cfg, attachement), c.Path(sum), sum, attachement.MimeType)
+}
+
+// storageKey returns the key of the attachment in the storage, <project>/<ID>/<file name>.
+// The Jira file names are not trusted, a name without a base name is replaced by the attachment ID.
+func storageKey(cfg *config.Config, attachement *jira.Attachment) string {
+	filename := path.Base(strings.ReplaceAll(attachement.Filename, "\\", "/"))
+	if filename == "." || filename == ".." || filename == "/" {
+		filename = attachement.ID
+	}
+	return fmt.Sprintf("%s/%s/%s", cfg.Jira.Name, attachement.ID, filename)
+}
+
+func getCachedJiraAttachmentSize(src jirax.Source, attachement *jira.Attachment) (int64, error) {
+	sum, err := getCachedJiraAttachment(src, attachement)
+	if err != nil {
+		return 0, errors.Wrap(err, "Error downloading file")
+	}
+
+	c, err := cache.GetCache()
+	if err != nil {
+		return 0, errors.Wrap(err, "Error opening attachment cache")
+	}
+
+	info, err := os.Stat(c.Path(sum))
+	if err != nil {
+		return 0, errors.Wrap(err, "Error reading cached file")
+	}
+	return info.Size(), nil
+}
+
+func isTooLarge(err error) bool {
+	var errorResponse *gitlab.ErrorResponse
+	return errors.As(err, &errorResponse) && errorResponse.Response != nil && errorResponse.Response.StatusCode == http.StatusRequestEntityTooLarge
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", size)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+)
+
+func TestRejectAttachment(t *testing.T) {
+	policy := &config.AttachmentPolicy{
+		MaxSize: "10MB",
+		Allow:   []string{"image/*", ".pdf", "txt"},
+		Deny:    []string{"image/svg+xml"},
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		mimeType string
+		size     int64
+		want     string
+	}{
+		{"allowed mime type", "design.png", "image/png", 1 << 20, ""},
+		{"allowed extension", "spec.PDF", "application/octet-stream", 1 << 20, ""},
+		{"allowed extension without dot", "notes.txt", "", 10, ""},
+		{"too large", "video.png", "image/png", 11 << 20, "larger than 10.0 MB"},
+		{"denied", "logo.svg", "image/svg+xml", 10, "denied type"},
+		{"not allowed", "setup.exe", "application/x-msdownload", 10, "type not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rejectAttachment(policy, tt.filename, tt.mimeType, tt.size); got != tt.want {
+				t.Errorf("rejectAttachment() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := rejectAttachment(&config.AttachmentPolicy{}, "setup.exe", "", 1<<40); got != "" {
+		t.Errorf("rejectAttachment() of the default policy = %q, want no rejection", got)
+	}
+}
+
+func TestStorageKey(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Jira.Name = "SSP"
+
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"video.mp4", "SSP/10000/video.mp4"},
+		{"../../etc/passwd", "SSP/10000/passwd"},
+		{"C:\\Users\\report.txt", "SSP/10000/report.txt"},
+		{"..", "SSP/10000/10000"},
+		{".", "SSP/10000/10000"},
+		{"", "SSP/10000/10000"},
+	}
+
+	for _, tt := range tests {
+		if got := storageKey(cfg, &jira.Attachment{ID: "10000", Filename: tt.filename}); got != tt.want {
+			t.Errorf("storageKey(%q) = %q, want %q", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestConvertRejectedJiraAttachment(t *testing.T) {
+	defer resetSkippedAttachments()
+
+	cfg := &config.Config{}
+	cfg.Jira.Host = "https://jira.infograb.net"
+	attachment := &jira.Attachment{ID: "10000", Filename: "video.mp4"}
+
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{"skip", "*video.mp4 was not migrated: larger than 10.0 MB* <!-- Imported from Jira rejected attachment 10000 -->"},
+		{"link", "[video.mp4](https://jira.infograb.net/secure/attachment/10000/video.mp4) <!-- Imported from Jira rejected attachment 10000 -->"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			cfg.Attachment.Action = tt.action
+			got, err := convertRejectedJiraAttachment(cfg, nil, "SSP-1", attachment, 11<<20, "larger than 10.0 MB")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Markdown != tt.want || !got.Rejected {
+				t.Errorf("convertRejectedJiraAttachment() = %q, %t, want %q, true", got.Markdown, got.Rejected, tt.want)
+			}
+		})
+	}
+}
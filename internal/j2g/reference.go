@@ -0,0 +1,326 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"golang.org/x/sync/errgroup"
+)
+
+// The descriptions and notes are converted before all the epics and issues exist,
+// so the Jira keys and links to Jira are rewritten to GitLab references once they are migrated.
+
+var (
+	jiraKeyRegex        = regexp.MustCompile(`\b[A-Z][A-Z0-9_]+-\d+\b`)
+	markdownCodeRegex   = regexp.MustCompile("`[^`\n]*`")
+	markdownLinkPattern = `\[([^\]\n]*)\]\((%s)\)`
+)
+
+// jiraReferences maps the Jira keys to the migrated GitLab epics and issues
+type jiraReferences struct {
+	projectPath string
+	groupPath   string
+	issues      map[string]*gitlab.Issue
+	epics       map[string]*gitlab.Epic
+}
+
+func newJiraReferences(cfg *config.Config, epicLinks map[string]*JiraEpicLink, issueLinks map[string]*JiraIssueLink, targetEpics map[string]*gitlab.Epic, targetIssues map[string]*gitlab.Issue) *jiraReferences {
+	result := &jiraReferences{
+		projectPath: cfg.GitLab.Issue,
+		groupPath:   cfg.GitLab.Epic,
+		issues:      make(map[string]*gitlab.Issue),
+		epics:       make(map[string]*gitlab.Epic),
+	}
+
+	for key, issue := range targetIssues {
+		result.issues[key] = issue
+	}
+	for key, epic := range targetEpics {
+		result.epics[key] = epic
+	}
+	for key, link := range issueLinks {
+		result.issues[key] = link.gitlabIssue
+	}
+	for key, link := range epicLinks {
+		result.epics[key] = link.gitlabEpic
+	}
+	return result
+}
+
+// reference returns the GitLab reference and the web URL of the Jira key.
+// The references are short in the project of the issues or in the group of the epics, and fully qualified otherwise.
+func (r *jiraReferences) reference(key string, inProject bool) (string, string, bool) {
+	if issue, ok := r.issues[key]; ok {
+		if inProject {
+			return fmt.Sprintf("#%d", issue.IID), issue.WebURL, true
+		}
+		return fmt.Sprintf("%s#%d", r.projectPath, issue.IID), issue.WebURL, true
+	}
+
+	if epic, ok := r.epics[key]; ok {
+		if inProject {
+			return fmt.Sprintf("%s&%d", r.groupPath, epic.IID), epic.WebURL, true
+		}
+		return fmt.Sprintf("&%d", epic.IID), epic.WebURL, true
+	}
+
+	return "", "", false
+}
+
+// rewriteJiraReferences rewrites the plain Jira keys and the links to the Jira issues into GitLab references.
+// Code, the imported footer of descriptions and the original link of notes are kept.
+func rewriteJiraReferences(text string, jiraHost string, refs *jiraReferences, inProject bool) string {
+	browse := regexp.QuoteMeta(strings.TrimSuffix(jiraHost, "/")) + `/browse/([A-Z][A-Z0-9_]+-\d+)(?:\?[^\s)>\]]*)?`
+	linkRegex := regexp.MustCompile(fmt.Sprintf(markdownLinkPattern, browse))
+	autolinkRegex := regexp.MustCompile(`<` + browse + `>`)
+	urlRegex := regexp.MustCompile(browse)
+
+	rewrite := func(s string) string {
+		//* [label](https://jira/browse/KEY)
+		s = replaceAllSubmatchFunc(linkRegex, s, func(groups []string) string {
+			label, url, key := groups[1], groups[2], groups[3]
+			ref, webURL, ok := refs.reference(key, inProject)
+			if !ok {
+				return groups[0]
+			}
+			if label == key || label == url || label == "" {
+				return ref
+			}
+			return fmt.Sprintf("[%s](%s)", label, webURL)
+		})
+
+		//* <https://jira/browse/KEY> and https://jira/browse/KEY
+		for _, re := range []*regexp.Regexp{autolinkRegex, urlRegex} {
+			s = replaceAllSubmatchFunc(re, s, func(groups []string) string {
+				if ref, _, ok := refs.reference(groups[1], inProject); ok {
+					return ref
+				}
+				return groups[0]
+			})
+		}
+
+		//* KEY, but not in the paths of other links
+		var b strings.Builder
+		last := 0
+		for _, loc := range jiraKeyRegex.FindAllStringIndex(s, -1) {
+			if loc[0] > 0 && strings.ContainsRune("/-_.=?&#", rune(s[loc[0]-1])) {
+				continue
+			}
+			if ref, _, ok := refs.reference(s[loc[0]:loc[1]], inProject); ok {
+				b.WriteString(s[last:loc[0]])
+				b.WriteString(ref)
+				last = loc[1]
+			}
+		}
+		b.WriteString(s[last:])
+		return b.String()
+	}
+
+	lines := strings.Split(text, "\n")
+	fenced := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fenced = !fenced
+			continue
+		}
+		if fenced || importedFooterRegex.MatchString(line) || importedNoteRegex.MatchString(line) {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, loc := range markdownCodeRegex.FindAllStringIndex(line, -1) {
+			b.WriteString(rewrite(line[last:loc[0]]))
+			b.WriteString(line[loc[0]:loc[1]])
+			last = loc[1]
+		}
+		b.WriteString(rewrite(line[last:]))
+		lines[i] = b.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func replaceAllSubmatchFunc(re *regexp.Regexp, s string, repl func([]string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		groups := make([]string, len(loc)/2)
+		for i := range groups {
+			if loc[2*i] >= 0 {
+				groups[i] = s[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		b.WriteString(s[last:loc[0]])
+		b.WriteString(repl(groups))
+		last = loc[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// RewriteReferences rewrites the Jira keys and links in the descriptions and notes of the converted epics and issues.
+// The target epics and issues, e.g. the ones not updated by a sync, are only referenced.
+func RewriteReferences(gl *gitlab.Client, epicLinks map[string]*JiraEpicLink, issueLinks map[string]*JiraIssueLink, targetEpics map[string]*gitlab.Epic, targetIssues map[string]*gitlab.Issue) error {
+	var g errgroup.Group
+	g.SetLimit(5)
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	//* The notes of the other authors are updated as them in impersonate mode
+	currentUser, _, err := gl.Users.CurrentUser()
+	if err != nil {
+		return errors.Wrap(err, "Error getting current user for GitLab")
+	}
+
+	refs := newJiraReferences(cfg, epicLinks, issueLinks, targetEpics, targetIssues)
+	noteOptions := func(note *gitlab.Note) ([]gitlab.RequestOptionFunc, bool) {
+		if note.Author.ID == currentUser.ID {
+			return nil, true
+		}
+		if !cfg.GitLab.Impersonate {
+			return nil, false
+		}
+		return []gitlab.RequestOptionFunc{gitlab.WithSudo(note.Author.ID)}, true
+	}
+
+	for key, link := range issueLinks {
+		g.Go(func(key string, iid int) func() error {
+			return func() error {
+				pid := cfg.GitLab.Issue
+				gitlabIssue, _, err := gl.Issues.GetIssue(pid, iid)
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error getting GitLab issue: %s", key))
+				}
+
+				//* Only the descriptions written by j2lab are rewritten
+				_, imported := importedJiraKey(gitlabIssue.Description)
+				if description := rewriteJiraReferences(gitlabIssue.Description, cfg.Jira.Host, refs, true); imported && description != gitlabIssue.Description {
+					_, _, err := gl.Issues.UpdateIssue(pid, iid, &gitlab.UpdateIssueOptions{
+						Description: &description,
+					})
+					if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error rewriting references of issue: %s", key))
+					}
+					log.Infof("Rewrote references of issue %s(%d)", key, iid)
+				}
+
+				notes, err := gitlabx.Unpaginate[gitlab.Note](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+					return gl.Notes.ListIssueNotes(pid, iid, &gitlab.ListIssueNotesOptions{ListOptions: *opt})
+				})
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error listing notes of issue: %s", key))
+				}
+
+				for _, note := range notes {
+					//* The notes written in GitLab after the import are kept
+					if note.System || !isImportedNote(note.Body) {
+						continue
+					}
+					body := rewriteJiraReferences(note.Body, cfg.Jira.Host, refs, true)
+					if body == note.Body {
+						continue
+					}
+
+					options, ok := noteOptions(note)
+					if !ok {
+						log.Warnf("Skipping note %d of issue %s written by %s", note.ID, key, note.Author.Username)
+						continue
+					}
+
+					_, _, err := gl.Notes.UpdateIssueNote(pid, iid, note.ID, &gitlab.UpdateIssueNoteOptions{Body: &body}, options...)
+					if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error rewriting references of note %d: issue %s", note.ID, key))
+					}
+				}
+
+				return nil
+			}
+		}(key, link.gitlabIssue.IID))
+	}
+
+	if err := g.Wait(); err != nil {
+		return errors.Wrap(err, "Error rewriting references of issues")
+	}
+
+	for key, link := range epicLinks {
+		g.Go(func(key string, iid int) func() error {
+			return func() error {
+				gid := cfg.GitLab.Epic
+				gitlabEpic, _, err := gl.Epics.GetEpic(gid, iid)
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error getting GitLab epic: %s", key))
+				}
+
+				//* Only the descriptions written by j2lab are rewritten
+				_, imported := importedJiraKey(gitlabEpic.Description)
+				if description := rewriteJiraReferences(gitlabEpic.Description, cfg.Jira.Host, refs, false); imported && description != gitlabEpic.Description {
+					_, _, err := gl.Epics.UpdateEpic(gid, iid, &gitlab.UpdateEpicOptions{
+						Description: &description,
+					})
+					if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error rewriting references of epic: %s", key))
+					}
+					log.Infof("Rewrote references of epic %s(%d)", key, iid)
+				}
+
+				notes, err := gitlabx.Unpaginate[gitlab.Note](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+					return gl.Notes.ListEpicNotes(gid, gitlabEpic.ID, &gitlab.ListEpicNotesOptions{ListOptions: *opt})
+				})
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error listing notes of epic: %s", key))
+				}
+
+				for _, note := range notes {
+					//* The notes written in GitLab after the import are kept
+					if note.System || !isImportedNote(note.Body) {
+						continue
+					}
+					body := rewriteJiraReferences(note.Body, cfg.Jira.Host, refs, false)
+					if body == note.Body {
+						continue
+					}
+
+					options, ok := noteOptions(note)
+					if !ok {
+						log.Warnf("Skipping note %d of epic %s written by %s", note.ID, key, note.Author.Username)
+						continue
+					}
+
+					_, _, err := gl.Notes.UpdateEpicNote(gid, gitlabEpic.ID, note.ID, &gitlab.UpdateEpicNoteOptions{Body: &body}, options...)
+					if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error rewriting references of note %d: epic %s", note.ID, key))
+					}
+				}
+
+				return nil
+			}
+		}(key, link.gitlabEpic.IID))
+	}
+
+	if err := g.Wait(); err != nil {
+		return errors.Wrap(err, "Error rewriting references of epics")
+	}
+
+	return nil
+}
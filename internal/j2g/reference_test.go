@@ -0,0 +1,49 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestRewriteJiraReferences(t *testing.T) {
+	refs := &jiraReferences{
+		projectPath: "infograb/j2lab",
+		groupPath:   "infograb",
+		issues: map[string]*gitlab.Issue{
+			"SSP-1": {IID: 11, WebURL: "https://gitlab.com/infograb/j2lab/-/issues/11"},
+		},
+		epics: map[string]*gitlab.Epic{
+			"SSP-2": {IID: 3, WebURL: "https://gitlab.com/groups/infograb/-/epics/3"},
+		},
+	}
+	host := "https://jira.infograb.net"
+
+	text := "See SSP-1 and SSP-2, not SSP-3.\n" +
+		"[SSP-1](https://jira.infograb.net/browse/SSP-1) [the epic](https://jira.infograb.net/browse/SSP-2)\n" +
+		"<https://jira.infograb.net/browse/SSP-1> https://jira.infograb.net/browse/SSP-2?focusedCommentId=1\n" +
+		"`SSP-1` https://example.com/SSP-1\n" +
+		"```\nSSP-1\n```\n" +
+		"Imported from Jira [SSP-1](https://jira.infograb.net/browse/SSP-1)"
+
+	assert.Equal(t, "See #11 and infograb&3, not SSP-3.\n"+
+		"#11 [the epic](https://gitlab.com/groups/infograb/-/epics/3)\n"+
+		"#11 infograb&3\n"+
+		"`SSP-1` https://example.com/SSP-1\n"+
+		"```\nSSP-1\n```\n"+
+		"Imported from Jira [SSP-1](https://jira.infograb.net/browse/SSP-1)",
+		rewriteJiraReferences(text, host, refs, true))
+
+	assert.Equal(t, "infograb/j2lab#11 &3", rewriteJiraReferences("SSP-1 SSP-2", host, refs, false))
+}
@@ -0,0 +1,275 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"gitlab.com/infograb-public/j2lab/internal/state"
+	"golang.org/x/sync/errgroup"
+)
+
+// Rollback is every GitLab object j2lab created, to be deleted.
+// The objects are the ones recorded in the state file, and the epics and issues with the "Imported from Jira" footer.
+// An epic or issue whose footer does not match its recorded Jira key is never deleted.
+type Rollback struct {
+	Issues       []*state.Entry
+	Epics        []*state.Entry
+	Milestones   []*state.Entry
+	Iterations   []*state.Entry
+	Labels       []*state.Entry
+	GroupLabels  []*state.Entry
+	Uploads      []*state.Entry
+	GroupUploads []*state.Entry
+}
+
+func (r *Rollback) Count() int {
+	return len(r.Issues) + len(r.Epics) + len(r.Milestones) + len(r.Iterations) + len(r.Labels) + len(r.GroupLabels) + len(r.Uploads) + len(r.GroupUploads)
+}
+
+// uniqueEntries returns the latest entry of each object, the same object is recorded again by resumed runs and syncs
+func uniqueEntries(entries []*state.Entry, key func(*state.Entry) string) []*state.Entry {
+	index := make(map[string]int)
+	result := []*state.Entry{}
+	for _, entry := range entries {
+		k := key(entry)
+		if i, ok := index[k]; ok {
+			result[i] = entry
+			continue
+		}
+		index[k] = len(result)
+		result = append(result, entry)
+	}
+	return result
+}
+
+func isNotFound(resp *gitlab.Response) bool {
+	return resp != nil && resp.StatusCode == http.StatusNotFound
+}
+
+func NewRollback(gl *gitlab.Client, store *state.Store) (*Rollback, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting config")
+	}
+	return newRollback(gl, cfg, store)
+}
+
+// isJiraProjectKey returns whether the Jira key is an issue of the project of the config.
+// The group and project may hold the imports of other Jira projects, which are kept.
+func isJiraProjectKey(cfg *config.Config, key string) bool {
+	return strings.HasPrefix(key, cfg.Jira.Name+"-")
+}
+
+func newRollback(gl *gitlab.Client, cfg *config.Config, store *state.Store) (*Rollback, error) {
+	byKey := func(entry *state.Entry) string { return entry.Parent + "/" + entry.Key }
+	byID := func(entry *state.Entry) string { return fmt.Sprintf("%s/%d", entry.Parent, entry.ID) }
+
+	r := &Rollback{
+		Milestones:  uniqueEntries(store.Entries(state.KindMilestone), byID),
+		Iterations:  uniqueEntries(store.Entries(state.KindIteration), byID),
+		Labels:      uniqueEntries(store.Entries(state.KindLabel), byKey),
+		GroupLabels: uniqueEntries(store.Entries(state.KindGroupLabel), byKey),
+		Uploads: uniqueEntries(store.Entries(state.KindAttachment), func(entry *state.Entry) string {
+			return entry.Parent + entry.URL
+		}),
+		GroupUploads: uniqueEntries(store.Entries(state.KindGroupAttachment), func(entry *state.Entry) string {
+			return entry.Parent + entry.URL
+		}),
+	}
+
+	//* Issues
+	importedIssues, err := findImportedIssues(gl, cfg.GitLab.Issue)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error finding GitLab issues imported by a previous run")
+	}
+
+	for _, entry := range uniqueEntries(store.Entries(state.KindIssue), byKey) {
+		issue, resp, err := gl.Issues.GetIssue(entry.Parent, entry.IID)
+		if isNotFound(resp) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error getting GitLab issue: %s", entry.Key))
+		}
+
+		if key, ok := importedJiraKey(issue.Description); !ok || key != entry.Key || !isJiraProjectKey(cfg, key) {
+			log.Warnf("Keeping issue %s#%d, it is not the import of %s", entry.Parent, entry.IID, entry.Key)
+			continue
+		}
+		if imported, ok := importedIssues[entry.Key]; ok && imported.ID == issue.ID {
+			delete(importedIssues, entry.Key)
+		}
+		r.Issues = append(r.Issues, entry)
+	}
+	for key, issue := range importedIssues {
+		if !isJiraProjectKey(cfg, key) {
+			continue
+		}
+		r.Issues = append(r.Issues, &state.Entry{Kind: state.KindIssue, Key: key, ID: issue.ID, IID: issue.IID, Parent: fmt.Sprint(issue.ProjectID)})
+	}
+
+	//* Epics
+	importedEpics, err := findImportedEpics(gl, cfg.GitLab.Epic)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error finding GitLab epics imported by a previous run")
+	}
+
+	for _, entry := range uniqueEntries(store.Entries(state.KindEpic), byKey) {
+		epic, resp, err := gl.Epics.GetEpic(entry.Parent, entry.IID)
+		if isNotFound(resp) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error getting GitLab epic: %s", entry.Key))
+		}
+
+		if key, ok := importedJiraKey(epic.Description); !ok || key != entry.Key || !isJiraProjectKey(cfg, key) {
+			log.Warnf("Keeping epic %s&%d, it is not the import of %s", entry.Parent, entry.IID, entry.Key)
+			continue
+		}
+		if imported, ok := importedEpics[entry.Key]; ok && imported.ID == epic.ID {
+			delete(importedEpics, entry.Key)
+		}
+		r.Epics = append(r.Epics, entry)
+	}
+	for key, epic := range importedEpics {
+		if !isJiraProjectKey(cfg, key) {
+			continue
+		}
+		r.Epics = append(r.Epics, &state.Entry{Kind: state.KindEpic, Key: key, ID: epic.ID, IID: epic.IID, Parent: fmt.Sprint(epic.GroupID)})
+	}
+
+	return r, nil
+}
+
+func (r *Rollback) WriteText(w io.Writer) {
+	writeEntries := func(title string, entries []*state.Entry, format func(*state.Entry) string) {
+		fmt.Fprintf(w, "\n%s: %d to delete\n", title, len(entries))
+		for _, entry := range entries {
+			fmt.Fprintf(w, "  - %s\n", format(entry))
+		}
+	}
+
+	writeEntries("Issues", r.Issues, func(e *state.Entry) string { return fmt.Sprintf("%s#%d (%s)", e.Parent, e.IID, e.Key) })
+	writeEntries("Epics", r.Epics, func(e *state.Entry) string { return fmt.Sprintf("%s&%d (%s)", e.Parent, e.IID, e.Key) })
+	writeEntries("Milestones", r.Milestones, func(e *state.Entry) string { return fmt.Sprintf("%s %s", e.Parent, e.Key) })
+	writeEntries("Iterations", r.Iterations, func(e *state.Entry) string { return fmt.Sprintf("%s %d (sprint %s)", e.Parent, e.ID, e.Key) })
+	writeEntries("Project labels", r.Labels, func(e *state.Entry) string { return fmt.Sprintf("%s %s", e.Parent, e.Key) })
+	writeEntries("Group labels", r.GroupLabels, func(e *state.Entry) string { return fmt.Sprintf("%s %s", e.Parent, e.Key) })
+	writeEntries("Uploads", r.Uploads, func(e *state.Entry) string { return fmt.Sprintf("%s %s", e.Parent, e.URL) })
+	writeEntries("Group uploads", r.GroupUploads, func(e *state.Entry) string { return fmt.Sprintf("%s %s", e.Parent, e.URL) })
+}
+
+// Execute deletes the objects, the ones already deleted are ignored.
+// The rollback is recorded, so the next run starts from scratch.
+func (r *Rollback) Execute(gl *gitlab.Client, store *state.Store) error {
+	var g errgroup.Group
+	g.SetLimit(5)
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	deleteAll := func(title string, entries []*state.Entry, del func(*state.Entry) (*gitlab.Response, error)) error {
+		for _, entry := range entries {
+			g.Go(func(entry *state.Entry) func() error {
+				return func() error {
+					resp, err := del(entry)
+					if isNotFound(resp) {
+						log.Debugf("%s already deleted: %s", title, entry.Key)
+						return nil
+					} else if err != nil {
+						return errors.Wrap(err, fmt.Sprintf("Error deleting %s: %s", title, entry.Key))
+					}
+					log.Infof("Deleted %s: %s", title, entry.Key)
+					return nil
+				}
+			}(entry))
+		}
+		return g.Wait()
+	}
+
+	//* Issues before the milestones, iterations and labels they use
+	err = deleteAll("issue", r.Issues, func(e *state.Entry) (*gitlab.Response, error) {
+		return gl.Issues.DeleteIssue(e.Parent, e.IID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting issues")
+	}
+
+	err = deleteAll("epic", r.Epics, func(e *state.Entry) (*gitlab.Response, error) {
+		return gl.Epics.DeleteEpic(e.Parent, e.IID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting epics")
+	}
+
+	err = deleteAll("milestone", r.Milestones, func(e *state.Entry) (*gitlab.Response, error) {
+		return gl.Milestones.DeleteMilestone(e.Parent, e.ID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting milestones")
+	}
+
+	err = deleteAll("iteration", r.Iterations, func(e *state.Entry) (*gitlab.Response, error) {
+		return gitlabx.DeleteIteration(gl, e.ID)
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting iterations")
+	}
+
+	err = deleteAll("label", r.Labels, func(e *state.Entry) (*gitlab.Response, error) {
+		return gl.Labels.DeleteLabel(e.Parent, &gitlab.DeleteLabelOptions{Name: gitlab.String(e.Key)})
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting project labels")
+	}
+
+	err = deleteAll("group label", r.GroupLabels, func(e *state.Entry) (*gitlab.Response, error) {
+		return gl.GroupLabels.DeleteGroupLabel(e.Parent, &gitlab.DeleteGroupLabelOptions{Name: gitlab.String(e.Key)})
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting group labels")
+	}
+
+	err = deleteAll("upload", r.Uploads, func(e *state.Entry) (*gitlab.Response, error) {
+		return gitlabx.DeleteProjectUpload(gl, e.Parent, e.URL)
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting uploads")
+	}
+
+	err = deleteAll("group upload", r.GroupUploads, func(e *state.Entry) (*gitlab.Response, error) {
+		return gitlabx.DeleteGroupUpload(gl, e.Parent, e.URL)
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error deleting group uploads")
+	}
+
+	err = store.Put(&state.Entry{
+		Kind: state.KindRollback,
+		Key:  cfg.Jira.Name,
+	})
+	if err != nil {
+		return errors.Wrap(err, "Error recording rollback")
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/state"
+)
+
+func TestNewRollback(t *testing.T) {
+	footer := func(key string) string {
+		return "Imported from Jira [" + key + "](https://jira.infograb.net/browse/" + key + ")"
+	}
+
+	gl := newTestGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/issues"):
+			writeJSON(t, w, []*gitlab.Issue{
+				{ID: 101, IID: 1, ProjectID: 10, Description: footer("SSP-1")},
+				//* The project is shared with the imports of another Jira project
+				{ID: 102, IID: 2, ProjectID: 10, Description: footer("ABC-1")},
+			})
+		case strings.HasSuffix(r.URL.Path, "/epics"):
+			epics := []*gitlab.Epic{
+				{ID: 201, IID: 1, GroupID: 20, Description: footer("SSP-2")},
+				{ID: 202, IID: 2, GroupID: 20, Description: footer("ABC-2")},
+			}
+			//* The epic of a subgroup has the IID of another epic of the group
+			if r.URL.Query().Get("include_descendant_groups") != "false" {
+				epics = append(epics, &gitlab.Epic{ID: 301, IID: 2, GroupID: 30, Description: footer("SSP-3")})
+			}
+			writeJSON(t, w, epics)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	store, err := state.Open(filepath.Join(t.TempDir(), "j2lab.state.jsonl"), true)
+	require.NoError(t, err)
+	defer store.Close()
+
+	cfg := &config.Config{}
+	cfg.Jira.Name = "SSP"
+	cfg.GitLab.Issue = "infograb/poc/ssp"
+	cfg.GitLab.Epic = "infograb/poc"
+
+	rollback, err := newRollback(gl, cfg, store)
+	require.NoError(t, err)
+
+	assert.Equal(t, []*state.Entry{{Kind: state.KindIssue, Key: "SSP-1", ID: 101, IID: 1, Parent: "10"}}, rollback.Issues)
+	assert.Equal(t, []*state.Entry{{Kind: state.KindEpic, Key: "SSP-2", ID: 201, IID: 1, Parent: "20"}}, rollback.Epics)
+}
@@ -20,7 +20,21 @@ import (
 	"gitlab.com/infograb-public/j2lab/internal/config"
 )
 
+// The text is wiki markup for Jira Server and an ADF document for Jira Cloud
 func textToGitLabMarkdown(text string, userMap UserMap, attachments AttachmentMap, isProject bool) (string, []string, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Error getting config")
+	}
+
+	if cfg.IsJiraCloud() {
+		result, usedAttachments, err := ADFToMD(text, attachments, userMap)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "Error converting ADF to GitLab Markdown")
+		}
+		return result, usedAttachments, nil
+	}
+
 	result, usedAttachments, err := JiraToMD(text, attachments, userMap)
 	if err != nil {
 		return "", nil, errors.Wrap(err, "Error converting Jira to GitLab Markdown")
@@ -30,7 +44,8 @@ func textToGitLabMarkdown(text string, userMap UserMap, attachments AttachmentMa
 }
 
 // comment -> comments : GitLab 작성자는 API owner이지만, 텍스트로 Jira 작성자를 표현
-func formatNote(issueKey string, jiraComment *jira.Comment, userMap UserMap, attachments AttachmentMap, isProject bool) (*string, *time.Time, []string, error) {
+// If the note is created as the author with sudo, the author is not written in the text.
+func formatNote(issueKey string, jiraComment *jira.Comment, userMap UserMap, attachments AttachmentMap, isProject bool, impersonated bool) (*string, *time.Time, []string, error) {
 	created, err := time.Parse("2006-01-02T15:04:05.000-0700", jiraComment.Created)
 	if err != nil {
 		return nil, nil, nil, errors.Wrap(err, "Error parsing time")
@@ -41,7 +56,7 @@ func formatNote(issueKey string, jiraComment *jira.Comment, userMap UserMap, att
 		return nil, nil, nil, errors.Wrap(err, "Error getting config")
 	}
 
-	commentLink := fmt.Sprintf("%s/browse/%s?focusedCommentId=%s", cfg.Jira.Host, issueKey, jiraComment.ID)
+	commentLink := jiraCommentLink(cfg, issueKey, jiraComment.ID)
 	dateFormat := fmt.Sprintf("%s at %s", created.Format("January 02, 2006"), created.Format("3:04 PM"))
 
 	markdownBody, usedAttachments, err := textToGitLabMarkdown(jiraComment.Body, userMap, attachments, isProject)
@@ -49,6 +64,11 @@ func formatNote(issueKey string, jiraComment *jira.Comment, userMap UserMap, att
 		return nil, nil, nil, errors.Wrap(err, "Error converting Text to GitLab Markdown")
 	}
 
+	if impersonated {
+		result := fmt.Sprintf("%s\n\n%s [[Original](%s)]", markdownBody, dateFormat, commentLink)
+		return &result, &created, usedAttachments, nil
+	}
+
 	result := fmt.Sprintf("%s\n\n%s by %s [[Original](%s)]",
 		markdownBody, dateFormat, jiraComment.Author.DisplayName, commentLink)
 	return &result, &created, usedAttachments, nil
@@ -64,6 +84,10 @@ func formatDescription(issue *jira.Issue, userMap UserMap, attachments Attachmen
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "Error converting Text to GitLab Markdown")
 	}
-	result := fmt.Sprintf("%s\n\nImported from Jira [%s](%s/browse/%s)", markdownDescription, issue.Key, cfg.Jira.Host, issue.Key)
+	result := fmt.Sprintf("%s\n\n%s [%s](%s/browse/%s)", markdownDescription, importedFooter, issue.Key, cfg.Jira.Host, issue.Key)
 	return &result, usedAttachments, nil
 }
+
+func jiraCommentLink(cfg *config.Config, issueKey string, commentID string) string {
+	return fmt.Sprintf("%s/browse/%s?focusedCommentId=%s", cfg.Jira.Host, issueKey, commentID)
+}
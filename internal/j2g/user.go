@@ -18,55 +18,127 @@ import (
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
 	"golang.org/x/sync/errgroup"
 )
 
 // Jira Username -> GitLab ID
 type UserMap map[string]*gitlab.User
 
-func newUserMap(gl *gitlab.Client, jiraIssues []*jira.Issue, users map[string]int) (UserMap, error) {
+// The users of the issues must be mapped and members of the GitLab project.
+// The comment authors are also mapped in impersonate mode, to create the comments as them.
+func newUserMap(gl *gitlab.Client, jiraIssues []*jira.Issue, cfg *config.Config, members map[int]bool) (UserMap, error) {
 	var g errgroup.Group
 	g.SetLimit(10)
 	mutex := sync.RWMutex{}
 
-	jiraUsernames, err := GetJiraUsernamesFromIssues(jiraIssues)
+	users := cfg.Users
+	jiraUsernames, err := GetJiraUsernamesFromIssues(cfg, jiraIssues)
 	if err != nil {
 		return nil, errors.Wrap(err, "Error getting Jira users from issues")
 	}
 
 	userMap := make(UserMap)
+	optional := make(map[string]bool)
+	getUser := func(gitlabID int, jiraUsername string) func() error {
+		return func() error {
+			gitlabUser, _, err := gl.Users.GetUser(gitlabID, gitlab.GetUsersOptions{})
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Error getting GitLab user %d", gitlabID))
+			}
+
+			mutex.Lock()
+			userMap[jiraUsername] = gitlabUser
+			mutex.Unlock()
+
+			return nil
+		}
+	}
+
+	required := make(map[string]bool)
 	for _, jiraUsername := range jiraUsernames {
+		required[jiraUsername] = true
 		gitlabID, ok := users[jiraUsername]
 		if !ok {
 			return nil, errors.New(fmt.Sprintf("No GitLab user found for Jira account ID %s", jiraUsername))
 		}
+		g.Go(getUser(gitlabID, jiraUsername))
+	}
 
-		g.Go(func(gitlabID int, jiraUsername string) func() error {
-			return func() error {
-				gitlabUser, _, err := gl.Users.GetUser(gitlabID, gitlab.GetUsersOptions{})
-				if err != nil {
-					return errors.Wrap(err, fmt.Sprintf("Error getting GitLab user %d", gitlabID))
-				}
-
-				mutex.Lock()
-				userMap[jiraUsername] = gitlabUser
-				mutex.Unlock()
-
-				return nil
-			}
-		}(gitlabID, jiraUsername))
+	//* Worklog and comment authors are optional, the authors not in users are written in the text
+	for _, jiraUsername := range getJiraAuthors(cfg, jiraIssues) {
+		gitlabID, ok := users[jiraUsername]
+		if !ok || required[jiraUsername] {
+			continue
+		}
+		optional[jiraUsername] = true
+		g.Go(getUser(gitlabID, jiraUsername))
 	}
 
 	if err := g.Wait(); err != nil {
 		return nil, errors.Wrap(err, "Error getting GitLab users")
 	}
 
+	for jiraUsername, user := range userMap {
+		if members[user.ID] {
+			continue
+		}
+		if !optional[jiraUsername] {
+			return nil, errors.Errorf("User %s with id %d is not a member of GitLab project %s", user.Username, user.ID, cfg.GitLab.Issue)
+		}
+		log.Warnf("User %s with id %d is not a member of GitLab project %s, writing %s in the text", user.Username, user.ID, cfg.GitLab.Issue, jiraUsername)
+		delete(userMap, jiraUsername)
+	}
+
 	return userMap, nil
 }
 
-// @Ouput: Jira User List
-func GetJiraUsernamesFromIssues(issues []*jira.Issue) ([]string, error) {
+func getJiraAuthors(cfg *config.Config, issues []*jira.Issue) []string {
+	result := []string{}
+	exist := make(map[string]bool)
+	add := func(user *jira.User) {
+		if key := cfg.JiraUserKey(user); key != "" && !exist[key] {
+			exist[key] = true
+			result = append(result, key)
+		}
+	}
+
+	for _, issue := range issues {
+		if issue.Fields.Worklog != nil {
+			for _, worklog := range issue.Fields.Worklog.Worklogs {
+				add(worklog.Author)
+			}
+		}
+		if cfg.GitLab.Impersonate && issue.Fields.Comments != nil {
+			for _, comment := range issue.Fields.Comments.Comments {
+				add(&comment.Author)
+			}
+		}
+	}
+	return result
+}
+
+// sudo returns the request options to act as the GitLab user mapped to the Jira user.
+// Without impersonate mode or for unmapped users, the requests are made as the token owner.
+func sudo(cfg *config.Config, userMap UserMap, jiraUser *jira.User) ([]gitlab.RequestOptionFunc, bool) {
+	if !cfg.GitLab.Impersonate || jiraUser == nil {
+		return nil, false
+	}
+
+	user, ok := userMap[cfg.JiraUserKey(jiraUser)]
+	if !ok {
+		return nil, false
+	}
+	return []gitlab.RequestOptionFunc{gitlab.WithSudo(user.ID)}, true
+}
+
+// Jira Cloud mentions are [~accountid:ID], Jira Server mentions are [~username]
+var jiraMentionRegex = regexp.MustCompile(`(?m)\[~(?:accountid:)?([^]]+)\]`)
+
+// @Ouput: Jira User List, usernames or account IDs for Jira Cloud
+func GetJiraUsernamesFromIssues(cfg *config.Config, issues []*jira.Issue) ([]string, error) {
 	usernameArray := make([]string, 0)
 	for _, issue := range issues {
 		// TODO: API를 분석해서 User를 판단할 구석을 만들어야 함
@@ -75,27 +147,32 @@ func GetJiraUsernamesFromIssues(issues []*jira.Issue) ([]string, error) {
 
 		//* Assignee
 		if assignee != nil {
-			usernameArray = append(usernameArray, assignee.Name)
+			usernameArray = append(usernameArray, cfg.JiraUserKey(assignee))
 		}
 
 		//* Reporter
 		if reporter != nil {
-			usernameArray = append(usernameArray, reporter.Name)
+			usernameArray = append(usernameArray, cfg.JiraUserKey(reporter))
 		}
 
-		re := regexp.MustCompile(`(?m)\[~([^]]+)\]`)
+		mentions := func(text string) []string {
+			if cfg.IsJiraCloud() {
+				return adfMentions(text)
+			}
+			result := []string{}
+			for _, match := range jiraMentionRegex.FindAllStringSubmatch(text, -1) {
+				result = append(result, match[1])
+			}
+			return result
+		}
 
 		//* Description
-		newUserAccountIds := re.FindAllStringSubmatch(issue.Fields.Description, -1)
-		for _, newUserAccountId := range newUserAccountIds {
-			usernameArray = append(usernameArray, newUserAccountId[1])
-		}
+		usernameArray = append(usernameArray, mentions(issue.Fields.Description)...)
 
 		//* Comment
-		for _, comment := range issue.Fields.Comments.Comments {
-			newUserIds := re.FindAllStringSubmatch(comment.Body, -1)
-			for _, newUserId := range newUserIds {
-				usernameArray = append(usernameArray, newUserId[1])
+		if issue.Fields.Comments != nil {
+			for _, comment := range issue.Fields.Comments.Comments {
+				usernameArray = append(usernameArray, mentions(comment.Body)...)
 			}
 		}
 	}
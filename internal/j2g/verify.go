@@ -0,0 +1,356 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	gosync "sync"
+	"text/tabwriter"
+	"unicode"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"golang.org/x/sync/errgroup"
+)
+
+// Verification is the comparison of the Jira project with what exists in GitLab after a run.
+// Only read calls are made.
+type Verification struct {
+	JiraProject   string `json:"jira_project"`
+	GitLabProject string `json:"gitlab_project"`
+	GitLabGroup   string `json:"gitlab_group"`
+
+	Epics  VerifyCount `json:"epics"`
+	Issues VerifyCount `json:"issues"`
+
+	Mismatches []VerifyMismatch `json:"mismatches"`
+}
+
+type VerifyCount struct {
+	Jira   int `json:"jira"`
+	GitLab int `json:"gitlab"`
+}
+
+type VerifyMismatch struct {
+	Issue  string `json:"issue"`
+	Check  string `json:"check"`
+	Jira   string `json:"jira"`
+	GitLab string `json:"gitlab"`
+}
+
+const (
+	verifyMissing     = "missing"
+	verifyComments    = "comments"
+	verifyAttachments = "attachments"
+	verifyAssignee    = "assignee"
+	verifyMilestone   = "milestone"
+	verifyLabels      = "labels"
+	verifyState       = "state"
+	verifyParentEpic  = "parent epic"
+	verifyLink        = "link"
+)
+
+func (v *Verification) HasMismatches() bool {
+	return len(v.Mismatches) > 0
+}
+
+func NewVerification(gl *gitlab.Client, jr *jira.Client) (*Verification, error) {
+	var g errgroup.Group
+	g.SetLimit(5)
+	mutex := gosync.Mutex{}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting config")
+	}
+
+	v := &Verification{
+		JiraProject:   cfg.Jira.Name,
+		GitLabProject: cfg.GitLab.Issue,
+		GitLabGroup:   cfg.GitLab.Epic,
+		Mismatches:    []VerifyMismatch{},
+	}
+
+	//* Jira
+	jiraEpics, jiraIssues, err := GetJiraIssues(jr, cfg, cfg.Jira.Jql)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting Jira issues: %s", cfg.Jira.Name))
+	}
+
+	//* GitLab
+	importedEpics, err := findImportedEpics(gl, cfg.GitLab.Epic)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error finding GitLab epics imported by a previous run")
+	}
+
+	importedIssues, err := findImportedIssues(gl, cfg.GitLab.Issue)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error finding GitLab issues imported by a previous run")
+	}
+
+	v.Epics = VerifyCount{Jira: len(jiraEpics)}
+	v.Issues = VerifyCount{Jira: len(jiraIssues)}
+
+	report := func(mismatches []VerifyMismatch) {
+		mutex.Lock()
+		v.Mismatches = append(v.Mismatches, mismatches...)
+		mutex.Unlock()
+	}
+
+	//* Epics
+	for _, jiraEpic := range jiraEpics {
+		gitlabEpic, ok := importedEpics[jiraEpic.Key]
+		if !ok {
+			report([]VerifyMismatch{{jiraEpic.Key, verifyMissing, "epic", ""}})
+			continue
+		}
+		v.Epics.GitLab++
+
+		g.Go(func(jiraEpic *jira.Issue, gitlabEpic *gitlab.Epic) func() error {
+			return func() error {
+				notes, err := gitlabx.Unpaginate[gitlab.Note](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+					return gl.Notes.ListEpicNotes(cfg.GitLab.Epic, gitlabEpic.ID, &gitlab.ListEpicNotesOptions{ListOptions: *opt})
+				})
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error listing notes of epic: %s", jiraEpic.Key))
+				}
+
+				mismatches := verifyText(jiraEpic, gitlabEpic.Description, notes)
+				mismatches = append(mismatches, verifyLabelsAndState(cfg, jiraEpic, gitlabEpic.Labels, gitlabEpic.State)...)
+				report(mismatches)
+				return nil
+			}
+		}(jiraEpic, gitlabEpic))
+	}
+
+	//* Issues
+	for _, jiraIssue := range jiraIssues {
+		gitlabIssue, ok := importedIssues[jiraIssue.Key]
+		if !ok {
+			report([]VerifyMismatch{{jiraIssue.Key, verifyMissing, "issue", ""}})
+			continue
+		}
+		v.Issues.GitLab++
+
+		g.Go(func(jiraIssue *jira.Issue, gitlabIssue *gitlab.Issue) func() error {
+			return func() error {
+				notes, err := gitlabx.Unpaginate[gitlab.Note](gl, func(opt *gitlab.ListOptions) ([]*gitlab.Note, *gitlab.Response, error) {
+					return gl.Notes.ListIssueNotes(cfg.GitLab.Issue, gitlabIssue.IID, &gitlab.ListIssueNotesOptions{ListOptions: *opt})
+				})
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error listing notes of issue: %s", jiraIssue.Key))
+				}
+
+				relations, _, err := gl.IssueLinks.ListIssueRelations(cfg.GitLab.Issue, gitlabIssue.IID)
+				if err != nil {
+					return errors.Wrap(err, fmt.Sprintf("Error listing links of issue: %s", jiraIssue.Key))
+				}
+
+				mismatches := verifyText(jiraIssue, gitlabIssue.Description, notes)
+				mismatches = append(mismatches, verifyLabelsAndState(cfg, jiraIssue, gitlabIssue.Labels, gitlabIssue.State)...)
+				mismatches = append(mismatches, verifyIssueFields(cfg, jiraIssue, gitlabIssue, importedEpics)...)
+				mismatches = append(mismatches, verifyIssueLinks(jiraIssue, relations, importedIssues)...)
+				report(mismatches)
+				return nil
+			}
+		}(jiraIssue, gitlabIssue))
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, errors.Wrap(err, "Error verifying")
+	}
+
+	sort.SliceStable(v.Mismatches, func(i, j int) bool {
+		return v.Mismatches[i].Issue < v.Mismatches[j].Issue
+	})
+
+	return v, nil
+}
+
+// verifyText compares the comments and the attachments
+func verifyText(jiraIssue *jira.Issue, description string, notes []*gitlab.Note) []VerifyMismatch {
+	result := []VerifyMismatch{}
+	imported := indexImportedNotes(notes)
+
+	jiraComments := 0
+	if jiraIssue.Fields.Comments != nil {
+		jiraComments = len(jiraIssue.Fields.Comments.Comments)
+	}
+	if jiraComments != len(imported.comments) {
+		result = append(result, VerifyMismatch{jiraIssue.Key, verifyComments, fmt.Sprint(jiraComments), fmt.Sprint(len(imported.comments))})
+	}
+
+	//* An attachment is in the description or a comment, or in a note of its own.
+	//* The attachments not uploaded by the attachment policy are marked where they are written
+	bodies := []string{description}
+	for _, note := range notes {
+		bodies = append(bodies, note.Body)
+	}
+	text := strings.Join(bodies, "\n")
+
+	found := 0
+	for _, attachment := range jiraIssue.Fields.Attachments {
+		if _, ok := imported.attachment(attachment.ID); ok || strings.Contains(text, "/"+uploadedFilename(attachment.Filename)) || strings.Contains(text, importedRejectedAttachmentMarker(attachment.ID)) {
+			found++
+		}
+	}
+	if found != len(jiraIssue.Fields.Attachments) {
+		result = append(result, VerifyMismatch{jiraIssue.Key, verifyAttachments, fmt.Sprint(len(jiraIssue.Fields.Attachments)), fmt.Sprint(found)})
+	}
+
+	return result
+}
+
+// uploadedFilename is the file name sanitized by GitLab uploads
+func uploadedFilename(filename string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-+", r) {
+			return r
+		}
+		return '_'
+	}, filename)
+}
+
+func verifyLabelsAndState(cfg *config.Config, jiraIssue *jira.Issue, labels gitlab.Labels, state string) []VerifyMismatch {
+	result := []VerifyMismatch{}
+
+	existing := make(map[string]bool)
+	for _, label := range labels {
+		existing[label] = true
+	}
+
+	expected, _ := jiraIssueLabels(cfg, jiraIssue)
+	missing := []string{}
+	for _, label := range expected {
+		if !existing[label] {
+			missing = append(missing, label)
+		}
+	}
+	if len(missing) > 0 {
+		result = append(result, VerifyMismatch{jiraIssue.Key, verifyLabels, strings.Join(missing, ", "), ""})
+	}
+
+	expectedState := "opened"
+	if isJiraIssueClosed(cfg, jiraIssue) {
+		expectedState = "closed"
+	}
+	if state != expectedState {
+		result = append(result, VerifyMismatch{jiraIssue.Key, verifyState, expectedState, state})
+	}
+
+	return result
+}
+
+// verifyIssueFields compares the assignee, the milestone and the parent epic
+func verifyIssueFields(cfg *config.Config, jiraIssue *jira.Issue, gitlabIssue *gitlab.Issue, importedEpics map[string]*gitlab.Epic) []VerifyMismatch {
+	result := []VerifyMismatch{}
+
+	//* Assignee, only the Jira users in user.csv are assigned
+	if jiraIssue.Fields.Assignee != nil {
+		if id, ok := cfg.Users[cfg.JiraUserKey(jiraIssue.Fields.Assignee)]; ok {
+			assigned := false
+			usernames := []string{}
+			for _, assignee := range gitlabIssue.Assignees {
+				assigned = assigned || assignee.ID == id
+				usernames = append(usernames, assignee.Username)
+			}
+			if !assigned {
+				result = append(result, VerifyMismatch{jiraIssue.Key, verifyAssignee, jiraIssue.Fields.Assignee.DisplayName, strings.Join(usernames, ", ")})
+			}
+		}
+	}
+
+	//* Milestone
+	if len(jiraIssue.Fields.FixVersions) > 0 {
+		milestone := ""
+		if gitlabIssue.Milestone != nil {
+			milestone = gitlabIssue.Milestone.Title
+		}
+		if milestone != jiraIssue.Fields.FixVersions[0].Name {
+			result = append(result, VerifyMismatch{jiraIssue.Key, verifyMilestone, jiraIssue.Fields.FixVersions[0].Name, milestone})
+		}
+	}
+
+	//* Parent Epic
+	parentKey := jiraParentKey(cfg, jiraIssue)
+	if parentEpic, ok := importedEpics[parentKey]; ok {
+		if gitlabIssue.Epic == nil || gitlabIssue.Epic.IID != parentEpic.IID {
+			epic := ""
+			if gitlabIssue.Epic != nil {
+				epic = fmt.Sprintf("&%d", gitlabIssue.Epic.IID)
+			}
+			result = append(result, VerifyMismatch{jiraIssue.Key, verifyParentEpic, parentKey, epic})
+		}
+	}
+
+	return result
+}
+
+// verifyIssueLinks checks that the Jira links Link creates exist
+func verifyIssueLinks(jiraIssue *jira.Issue, relations []*gitlab.IssueRelation, importedIssues map[string]*gitlab.Issue) []VerifyMismatch {
+	result := []VerifyMismatch{}
+
+	linked := make(map[int]bool)
+	for _, relation := range relations {
+		linked[relation.IID] = true
+	}
+
+	//* The links are checked in both directions, GitLab lists them on both issues
+	for _, issueLink := range jiraIssue.Fields.IssueLinks {
+		linkedIssue := issueLink.OutwardIssue
+		if linkedIssue == nil {
+			linkedIssue = issueLink.InwardIssue
+		}
+		if linkedIssue == nil || linkedIssue.Key == jiraIssue.Key {
+			continue
+		}
+
+		target, ok := importedIssues[linkedIssue.Key]
+		if !ok {
+			continue
+		}
+		if !linked[target.IID] {
+			result = append(result, VerifyMismatch{jiraIssue.Key, verifyLink, fmt.Sprintf("%s %s", issueLink.Type.Name, linkedIssue.Key), ""})
+		}
+	}
+
+	return result
+}
+
+func (v *Verification) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Verify: Jira project %s -> GitLab project %s, group %s\n", v.JiraProject, v.GitLabProject, v.GitLabGroup)
+	fmt.Fprintf(w, "\nEpics: %d in Jira, %d in GitLab\n", v.Epics.Jira, v.Epics.GitLab)
+	fmt.Fprintf(w, "Issues: %d in Jira, %d in GitLab\n", v.Issues.Jira, v.Issues.GitLab)
+
+	if !v.HasMismatches() {
+		fmt.Fprintf(w, "\nNo mismatches found\n")
+		return
+	}
+
+	fmt.Fprintf(w, "\nMismatches: %d\n", len(v.Mismatches))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ISSUE\tCHECK\tJIRA\tGITLAB")
+	for _, m := range v.Mismatches {
+		gitlabValue := m.GitLab
+		if gitlabValue == "" {
+			gitlabValue = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.Issue, m.Check, m.Jira, gitlabValue)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,47 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package j2g
+
+import (
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/stretchr/testify/assert"
+	"github.com/xanzy/go-gitlab"
+)
+
+func TestVerifyText(t *testing.T) {
+	issue := &jira.Issue{
+		Key: "SSP-1",
+		Fields: &jira.IssueFields{
+			Comments: &jira.Comments{Comments: []*jira.Comment{{ID: "1"}, {ID: "2"}}},
+			Attachments: []*jira.Attachment{
+				{ID: "10", Filename: "screen shot.png"},
+				{ID: "11", Filename: "log.txt"},
+				{ID: "12", Filename: "missing.zip"},
+				{ID: "13", Filename: "video.mp4"},
+			},
+		},
+	}
+
+	notes := []*gitlab.Note{
+		{Body: "comment\n\nJanuary 02, 2006 at 3:04 PM [[Original](https://jira.infograb.net/browse/SSP-1?focusedCommentId=1)]"},
+		{Body: "[log.txt](/uploads/abc/log.txt)\n\n<!-- Imported from Jira attachment 11 -->"},
+	}
+
+	//* video.mp4 was rejected by the attachment policy
+	description := "![screen shot.png](/uploads/def/screen_shot.png)\n\n*video.mp4 was not migrated: larger than 10.0 MB* <!-- Imported from Jira rejected attachment 13 -->"
+
+	assert.Equal(t, []VerifyMismatch{
+		{"SSP-1", verifyComments, "2", "1"},
+		{"SSP-1", verifyAttachments, "4", "3"},
+	}, verifyText(issue, description, notes))
+}
@@ -0,0 +1,141 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package j2g
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	gitlab "github.com/xanzy/go-gitlab"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+	"gitlab.com/infograb-public/j2lab/internal/gitlabx"
+	"gitlab.com/infograb-public/j2lab/internal/jirax"
+)
+
+// GitLab limits the summary of a spent time
+const maxTimelogSummary = 255
+
+// Time Original Estimate -> Time Estimate
+func convertJiraTimeEstimate(gl *gitlab.Client, pid string, jiraIssue *jira.Issue, gitlabIssue *gitlab.Issue) error {
+	estimate := jiraIssue.Fields.TimeOriginalEstimate
+
+	var current int
+	if gitlabIssue.TimeStats != nil {
+		current = gitlabIssue.TimeStats.TimeEstimate
+	}
+
+	if estimate > 0 && estimate != current {
+		_, _, err := gl.Issues.SetTimeEstimate(pid, gitlabIssue.IID, &gitlab.SetTimeEstimateOptions{
+			Duration: gitlab.String(fmt.Sprintf("%ds", estimate)),
+		})
+		if err != nil {
+			return errors.Wrap(err, "Error setting time estimate")
+		}
+	} else if estimate == 0 && current > 0 {
+		_, _, err := gl.Issues.ResetTimeEstimate(pid, gitlabIssue.IID)
+		if err != nil {
+			return errors.Wrap(err, "Error resetting time estimate")
+		}
+	}
+
+	return nil
+}
+
+// The search results only include the first worklogs of an issue
+func getJiraWorklogs(src jirax.Source, jiraIssue *jira.Issue) ([]jira.WorklogRecord, error) {
+	worklog := jiraIssue.Fields.Worklog
+	if worklog != nil && worklog.Total <= len(worklog.Worklogs) {
+		return worklog.Worklogs, nil
+	}
+
+	return src.GetWorklogs(jiraIssue.Key)
+}
+
+// Worklog -> Spent Time
+// In impersonate mode the spent time is logged as the mapped GitLab user of the worklog author.
+// The worklogs already logged by a previous run are skipped, they are matched by date and duration.
+func convertJiraWorklogs(gl *gitlab.Client, src jirax.Source, pid string, jiraIssue *jira.Issue, gitlabIssue *gitlab.Issue, userMap UserMap, imported bool) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return errors.Wrap(err, "Error getting config")
+	}
+
+	worklogs, err := getJiraWorklogs(src, jiraIssue)
+	if err != nil {
+		return errors.Wrap(err, "Error getting Jira worklogs")
+	}
+	if len(worklogs) == 0 {
+		return nil
+	}
+
+	existing := make(map[string]bool)
+	if imported {
+		timelogs, err := gitlabx.ListIssueTimelogs(gl, pid, gitlabIssue.IID)
+		if err != nil {
+			return errors.Wrap(err, "Error getting GitLab timelogs")
+		}
+		for _, timelog := range timelogs {
+			existing[timelogKey(timelog.SpentAt, timelog.TimeSpent)] = true
+		}
+	}
+
+	for _, worklog := range worklogs {
+		if worklog.Started == nil || worklog.TimeSpentSeconds == 0 {
+			continue
+		}
+
+		spentAt := time.Time(*worklog.Started)
+		if existing[timelogKey(spentAt, worklog.TimeSpentSeconds)] {
+			continue
+		}
+
+		summary := worklog.Comment
+		if cfg.IsJiraCloud() && strings.HasPrefix(summary, "{") {
+			summary, _, err = ADFToMD(summary, nil, nil)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("Error converting comment of worklog %s", worklog.ID))
+			}
+		}
+		options, impersonated := sudo(cfg, userMap, worklog.Author)
+		if !impersonated && worklog.Author != nil {
+			summary = fmt.Sprintf("%s: %s", worklog.Author.DisplayName, summary)
+		}
+
+		_, err := gitlabx.CreateIssueTimelog(gl, gitlabIssue.ID, &gitlabx.CreateTimelogOptions{
+			TimeSpent: worklog.TimeSpentSeconds,
+			SpentAt:   spentAt,
+			Summary:   truncate(summary, maxTimelogSummary),
+		}, options...)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error creating timelog for worklog %s", worklog.ID))
+		}
+		log.Debugf("Created GitLab timelog from Jira worklog: %s", worklog.ID)
+	}
+
+	return nil
+}
+
+func timelogKey(spentAt time.Time, seconds int) string {
+	return fmt.Sprintf("%d/%d", spentAt.Unix(), seconds)
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
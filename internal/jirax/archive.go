@@ -0,0 +1,283 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package jirax
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+// An archive is a Jira project exported to a directory, to migrate it where Jira can not be reached.
+// The directory contains the manifest and the downloaded attachments:
+// - j2lab.json
+// - attachments/<Jira Attachment ID>/<Filename>
+
+// ArchiveVersion is the version of the manifest schema, increased on incompatible changes
+const ArchiveVersion = 1
+
+const ArchiveManifest = "j2lab.json"
+
+type Archive struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	//* The Jira site the project was exported from
+	Host   string `json:"host"`
+	Flavor string `json:"flavor"`
+
+	//* The project with its versions
+	Project *jira.Project `json:"project"`
+
+	//* The issues with their comments, complete worklogs and changelog
+	Epics  []*jira.Issue `json:"epics"`
+	Issues []*jira.Issue `json:"issues"`
+
+	Sprints  []*jira.Sprint `json:"sprints"`
+	Statuses []jira.Status  `json:"statuses"`
+
+	//* The authors, assignees, reporters and mentioned users
+	Users []*jira.User `json:"users"`
+
+	//* Jira Attachment ID -> path of the file relative to the archive directory
+	Attachments map[string]string `json:"attachments"`
+}
+
+func NewArchive(host string, flavor string) *Archive {
+	return &Archive{
+		Version:     ArchiveVersion,
+		ExportedAt:  time.Now(),
+		Host:        host,
+		Flavor:      flavor,
+		Epics:       []*jira.Issue{},
+		Issues:      []*jira.Issue{},
+		Sprints:     []*jira.Sprint{},
+		Statuses:    []jira.Status{},
+		Users:       []*jira.User{},
+		Attachments: make(map[string]string),
+	}
+}
+
+// AttachmentPath returns the path of the attachment relative to the archive directory.
+// The filename is reduced to its base name, the Jira filenames are not trusted.
+func AttachmentPath(attachment *jira.Attachment) string {
+	filename := filepath.Base(strings.ReplaceAll(attachment.Filename, "\\", "/"))
+	if filename == "." || filename == "/" || filename == ".." {
+		filename = "attachment"
+	}
+	return path.Join("attachments", attachment.ID, filename)
+}
+
+// Write writes the manifest into the archive directory
+func (a *Archive) Write(dir string) error {
+	data, err := json.MarshalIndent(a, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error marshalling archive manifest")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ArchiveManifest), append(data, '\n'), 0o644); err != nil {
+		return errors.Wrap(err, "Error writing archive manifest")
+	}
+	return nil
+}
+
+// ArchiveSource reads the Jira project from an exported archive, a directory or a tarball
+type ArchiveSource struct {
+	*Archive
+
+	dir    string
+	temp   bool
+	origin string //* Absolute path of the archive, backup or export
+	issues map[string]*jira.Issue
+}
+
+func OpenArchive(archivePath string) (*ArchiveSource, error) {
+	s := &ArchiveSource{dir: archivePath, origin: absPath(archivePath)}
+
+	//* The tarball is extracted into a temporary directory
+	if strings.HasSuffix(archivePath, ".tar.gz") || strings.HasSuffix(archivePath, ".tgz") {
+		dir, err := os.MkdirTemp("", "j2lab-import-")
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating temporary directory")
+		}
+		s.dir, s.temp = dir, true
+
+		if err := utils.ExtractTarGz(archivePath, dir); err != nil {
+			s.Close()
+			return nil, errors.Wrap(err, fmt.Sprintf("Error extracting archive: %s", archivePath))
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, ArchiveManifest))
+	if err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("Error reading archive manifest: %s", archivePath))
+	}
+
+	s.Archive = &Archive{}
+	if err := json.Unmarshal(data, s.Archive); err != nil {
+		s.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("Error parsing archive manifest: %s", archivePath))
+	}
+	if s.Version < 1 || s.Version > ArchiveVersion {
+		s.Close()
+		return nil, errors.Errorf("Unsupported archive version %d, this j2lab reads up to version %d", s.Version, ArchiveVersion)
+	}
+	if s.Project == nil {
+		s.Close()
+		return nil, errors.Errorf("No Jira project in archive: %s", archivePath)
+	}
+
+	s.indexIssues()
+	return s, nil
+}
+
+func (s *ArchiveSource) indexIssues() {
+	s.issues = make(map[string]*jira.Issue)
+	for _, issue := range append(append([]*jira.Issue{}, s.Epics...), s.Issues...) {
+		s.issues[issue.Key] = issue
+	}
+}
+
+// resolveAttachments finds the files of the attachments in the attachments directory of a Jira backup or export.
+// The files are named after the Jira attachment ID, e.g. <Project>/10000/<Issue>/<ID>, <ID>_<Filename> or <ID>/<Filename>.
+// The attachments without file are dropped from the issues.
+func resolveAttachments(archive *Archive, dir string) error {
+	files := make(map[string]string)
+	if dir != "" {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			name := info.Name()
+			if i := strings.Index(name, "_"); i > 0 {
+				name = name[:i]
+			}
+			for _, id := range []string{name, filepath.Base(filepath.Dir(path))} {
+				if _, ok := files[id]; !ok {
+					files[id] = rel
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error reading attachments directory: %s", dir))
+		}
+	}
+
+	for _, issue := range append(append([]*jira.Issue{}, archive.Epics...), archive.Issues...) {
+		attachments := []*jira.Attachment{}
+		for _, attachment := range issue.Fields.Attachments {
+			path, ok := files[attachment.ID]
+			if !ok {
+				log.Warnf("Skipping attachment %s (%s) of issue %s, its file is not in the attachments directory", attachment.Filename, attachment.ID, issue.Key)
+				continue
+			}
+			archive.Attachments[attachment.ID] = path
+			attachments = append(attachments, attachment)
+		}
+		issue.Fields.Attachments = attachments
+	}
+
+	return nil
+}
+
+// Origin returns the Jira site the archive was exported from, else the file itself as the backups and exports do not keep it
+func (s *ArchiveSource) Origin() string {
+	if u, err := url.Parse(s.Host); err == nil && u.Host != "" {
+		return u.Host + strings.TrimSuffix(u.Path, "/")
+	}
+	return s.origin
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Close removes the extracted tarball
+func (s *ArchiveSource) Close() error {
+	if !s.temp {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
+
+func (s *ArchiveSource) GetProject(projectKey string) (*jira.Project, error) {
+	if !strings.EqualFold(s.Project.Key, projectKey) {
+		return nil, errors.Errorf("Jira project %s is not in the archive of project %s", projectKey, s.Project.Key)
+	}
+	return s.Project, nil
+}
+
+// GetIssues returns the exported issues, the JQL was applied by the export
+func (s *ArchiveSource) GetIssues(projectKey string, jql string, expand ...string) ([]*jira.Issue, []*jira.Issue, error) {
+	if _, err := s.GetProject(projectKey); err != nil {
+		return nil, nil, err
+	}
+	return s.Epics, s.Issues, nil
+}
+
+func (s *ArchiveSource) GetWorklogs(issueKey string) ([]jira.WorklogRecord, error) {
+	issue, ok := s.issues[issueKey]
+	if !ok {
+		return nil, errors.Errorf("Issue %s is not in the archive", issueKey)
+	}
+	if issue.Fields.Worklog == nil {
+		return []jira.WorklogRecord{}, nil
+	}
+	return issue.Fields.Worklog.Worklogs, nil
+}
+
+// GetSprints returns the sprints of the board configured for the export
+func (s *ArchiveSource) GetSprints(boardID int) ([]*jira.Sprint, error) {
+	return s.Sprints, nil
+}
+
+func (s *ArchiveSource) DownloadAttachment(attachment *jira.Attachment) (io.ReadCloser, error) {
+	path, ok := s.Attachments[attachment.ID]
+	if !ok {
+		return nil, errors.Errorf("Attachment %s (%s) is not in the archive", attachment.Filename, attachment.ID)
+	}
+
+	//* The manifest is not trusted, the attachments must be inside of the archive
+	name := filepath.Join(s.dir, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(s.dir, name); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.Errorf("Invalid path of attachment %s (%s) in the archive: %s", attachment.Filename, attachment.ID, path)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error opening attachment %s", path))
+	}
+	return file, nil
+}
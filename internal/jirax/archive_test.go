@@ -0,0 +1,88 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package jirax
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/infograb-public/j2lab/internal/utils"
+)
+
+func TestAttachmentPath(t *testing.T) {
+	assert.Equal(t, "attachments/10001/screen shot.png", AttachmentPath(&jira.Attachment{ID: "10001", Filename: "screen shot.png"}))
+	assert.Equal(t, "attachments/10002/passwd", AttachmentPath(&jira.Attachment{ID: "10002", Filename: "../../etc/passwd"}))
+	assert.Equal(t, "attachments/10003/report.txt", AttachmentPath(&jira.Attachment{ID: "10003", Filename: "C:\\Users\\report.txt"}))
+	assert.Equal(t, "attachments/10004/attachment", AttachmentPath(&jira.Attachment{ID: "10004", Filename: ".."}))
+}
+
+func TestOpenArchive(t *testing.T) {
+	dir := t.TempDir()
+	attachment := &jira.Attachment{ID: "10001", Filename: "log.txt"}
+
+	archive := NewArchive("https://jira.infograb.net", "server")
+	archive.Project = &jira.Project{Key: "SSP"}
+	archive.Issues = append(archive.Issues, &jira.Issue{
+		Key: "SSP-1",
+		Fields: &jira.IssueFields{
+			Summary:     "Issue",
+			Attachments: []*jira.Attachment{attachment},
+			Worklog:     &jira.Worklog{Total: 1, MaxResults: 1, Worklogs: []jira.WorklogRecord{{TimeSpentSeconds: 3600}}},
+		},
+	})
+	archive.Attachments[attachment.ID] = AttachmentPath(attachment)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "attachments", "10001"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "attachments", "10001", "log.txt"), []byte("log"), 0o644))
+	require.NoError(t, archive.Write(dir))
+
+	tarball := filepath.Join(t.TempDir(), "SSP-export.tar.gz")
+	require.NoError(t, utils.TarGzDirectory(dir, tarball))
+
+	for _, path := range []string{dir, tarball} {
+		src, err := OpenArchive(path)
+		require.NoError(t, err)
+
+		_, issues, err := src.GetIssues("SSP", "")
+		require.NoError(t, err)
+		assert.Equal(t, "Issue", issues[0].Fields.Summary)
+
+		_, _, err = src.GetIssues("OTHER", "")
+		assert.Error(t, err)
+
+		worklogs, err := src.GetWorklogs("SSP-1")
+		require.NoError(t, err)
+		assert.Equal(t, 3600, worklogs[0].TimeSpentSeconds)
+
+		reader, err := src.DownloadAttachment(attachment)
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		assert.Equal(t, "log", string(content))
+
+		//* A crafted manifest can not read files outside of the archive
+		src.Attachments["10002"] = "../../../etc/passwd"
+		_, err = src.DownloadAttachment(&jira.Attachment{ID: "10002", Filename: "passwd"})
+		assert.Error(t, err)
+
+		require.NoError(t, src.Close())
+	}
+
+	archive.Version = ArchiveVersion + 1
+	require.NoError(t, archive.Write(dir))
+	_, err := OpenArchive(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,585 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package jirax
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+)
+
+// A Jira XML backup is the entities.xml file of a Jira Server, Data Center or Cloud backup.
+// Every row of the Jira database is an element, with the columns as attributes or as child elements for the long texts:
+//   <Issue id="10000" project="10000" number="1" summary="..." type="10001" status="1" reporter="admin" ...>
+//     <description><![CDATA[...]]></description>
+//   </Issue>
+// The backup holds every project of the site, only the issues of one project are read.
+
+// jiraTimeLayout is the layout of the string times of jira.Issue, e.g. the created time of comments
+const jiraTimeLayout = "2006-01-02T15:04:05.000-0700"
+
+// backupEntities are the entities read from the backup, the others are skipped
+var backupEntities = map[string]bool{
+	"Project":          true,
+	"Issue":            true,
+	"IssueType":        true,
+	"Status":           true,
+	"Resolution":       true,
+	"Priority":         true,
+	"Action":           true,
+	"FileAttachment":   true,
+	"Version":          true,
+	"Component":        true,
+	"NodeAssociation":  true,
+	"Label":            true,
+	"IssueLink":        true,
+	"IssueLinkType":    true,
+	"Worklog":          true,
+	"ChangeGroup":      true,
+	"ChangeItem":       true,
+	"CustomField":      true,
+	"CustomFieldValue": true,
+	"ApplicationUser":  true,
+	"User":             true,
+}
+
+type backupEntity map[string]string
+
+type backupElement struct {
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []struct {
+		XMLName xml.Name
+		Value   string `xml:",chardata"`
+	} `xml:",any"`
+}
+
+// readBackupEntities returns the rows of the read entities by entity name
+func readBackupEntities(r io.Reader) (map[string][]backupEntity, error) {
+	result := make(map[string][]backupEntity)
+	decoder := xml.NewDecoder(r)
+
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return result, nil
+		} else if err != nil {
+			return nil, errors.Wrap(err, "Error reading XML")
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			//* The entities are the children of <entity-engine-xml>
+			if depth != 1 {
+				depth++
+				continue
+			}
+			if !backupEntities[token.Name.Local] {
+				if err := decoder.Skip(); err != nil {
+					return nil, errors.Wrap(err, "Error reading XML")
+				}
+				continue
+			}
+
+			element := backupElement{}
+			if err := decoder.DecodeElement(&element, &token); err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Error reading %s", token.Name.Local))
+			}
+
+			entity := make(backupEntity)
+			for _, attr := range element.Attrs {
+				entity[attr.Name.Local] = attr.Value
+			}
+			for _, child := range element.Children {
+				entity[child.XMLName.Local] = child.Value
+			}
+			result[token.Name.Local] = append(result[token.Name.Local], entity)
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// parseBackupTime parses the times of the backup, e.g. 2023-01-02 10:00:00.0, in UTC
+func parseBackupTime(value string) (time.Time, bool) {
+	if i := strings.Index(value, "."); i > 0 {
+		value = value[:i]
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func formatBackupTime(value string) string {
+	if t, ok := parseBackupTime(value); ok {
+		return t.Format(jiraTimeLayout)
+	}
+	return ""
+}
+
+func backupTime(value string) *jira.Time {
+	if t, ok := parseBackupTime(value); ok {
+		result := jira.Time(t)
+		return &result
+	}
+	return nil
+}
+
+func backupDate(value string) string {
+	if t, ok := parseBackupTime(value); ok {
+		return t.Format("2006-01-02")
+	}
+	return ""
+}
+
+// OpenXMLBackup reads the issues of the Jira project from the entities.xml of a Jira backup.
+// The attachment files are found in the attachments directory of the backup.
+func OpenXMLBackup(entitiesPath string, attachmentsDir string, projectKey string) (*ArchiveSource, error) {
+	file, err := os.Open(entitiesPath)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error opening Jira backup: %s", entitiesPath))
+	}
+	defer file.Close()
+
+	entities, err := readBackupEntities(file)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error reading Jira backup: %s", entitiesPath))
+	}
+
+	archive, err := convertBackupEntities(entities, projectKey)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error converting Jira backup: %s", entitiesPath))
+	}
+
+	if err := resolveAttachments(archive, attachmentsDir); err != nil {
+		return nil, errors.Wrap(err, "Error resolving attachments")
+	}
+
+	s := &ArchiveSource{Archive: archive, dir: attachmentsDir, origin: absPath(entitiesPath)}
+	s.indexIssues()
+	return s, nil
+}
+
+func convertBackupEntities(entities map[string][]backupEntity, projectKey string) (*Archive, error) {
+	archive := NewArchive("", "server")
+
+	byID := func(name string) map[string]backupEntity {
+		result := make(map[string]backupEntity)
+		for _, entity := range entities[name] {
+			result[entity["id"]] = entity
+		}
+		return result
+	}
+
+	//* Project
+	var project backupEntity
+	projects := byID("Project")
+	for _, p := range projects {
+		if strings.EqualFold(p["key"], projectKey) {
+			project = p
+		}
+	}
+	if project == nil {
+		return nil, errors.Errorf("Jira project %s is not in the backup", projectKey)
+	}
+
+	//* Users, the issues refer to the user keys
+	userNames := make(map[string]string)
+	for _, user := range entities["ApplicationUser"] {
+		userNames[user["userKey"]] = user["lowerUserName"]
+	}
+	usersByName := make(map[string]backupEntity)
+	for _, user := range entities["User"] {
+		usersByName[strings.ToLower(user["userName"])] = user
+	}
+
+	users := make(map[string]*jira.User)
+	user := func(key string) *jira.User {
+		if key == "" {
+			return nil
+		}
+		if result, ok := users[key]; ok {
+			return result
+		}
+
+		name, ok := userNames[key]
+		if !ok {
+			name = key
+		}
+		result := &jira.User{Key: key, Name: name, DisplayName: name}
+		if u, ok := usersByName[strings.ToLower(name)]; ok {
+			result.Name = u["userName"]
+			result.DisplayName = u["displayName"]
+			result.EmailAddress = u["emailAddress"]
+			result.Active = u["active"] != "0"
+		}
+
+		users[key] = result
+		archive.Users = append(archive.Users, result)
+		return result
+	}
+
+	archive.Project = &jira.Project{
+		ID:          project["id"],
+		Key:         project["key"],
+		Name:        project["name"],
+		Description: project["description"],
+	}
+	if lead := user(project["lead"]); lead != nil {
+		archive.Project.Lead = *lead
+	}
+
+	//* Versions, in the order of the project
+	versions := []backupEntity{}
+	for _, version := range entities["Version"] {
+		if version["project"] == project["id"] {
+			versions = append(versions, version)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, _ := strconv.Atoi(versions[i]["sequence"])
+		b, _ := strconv.Atoi(versions[j]["sequence"])
+		return a < b
+	})
+	for _, version := range versions {
+		released := version["released"] == "true"
+		archived := version["archived"] == "true"
+		archive.Project.Versions = append(archive.Project.Versions, jira.Version{
+			ID:          version["id"],
+			Name:        version["name"],
+			Description: version["description"],
+			Released:    &released,
+			Archived:    &archived,
+			ReleaseDate: backupDate(version["releasedate"]),
+			StartDate:   backupDate(version["startdate"]),
+		})
+	}
+
+	//* Issues of every project, the links can target other projects
+	issueTypes := byID("IssueType")
+	statuses := byID("Status")
+	resolutions := byID("Resolution")
+	priorities := byID("Priority")
+	components := byID("Component")
+	versionsByID := byID("Version")
+
+	issues := make(map[string]*jira.Issue)
+	exported := []*jira.Issue{}
+	exportedByID := make(map[string]*jira.Issue)
+	usedStatuses := make(map[string]bool)
+	for _, entity := range entities["Issue"] {
+		key := entity["key"]
+		if key == "" {
+			key = fmt.Sprintf("%s-%s", projects[entity["project"]]["key"], entity["number"])
+		}
+
+		issueType := issueTypes[entity["type"]]
+		issue := &jira.Issue{
+			ID:  entity["id"],
+			Key: key,
+			Fields: &jira.IssueFields{
+				Type: jira.IssueType{
+					ID:          entity["type"],
+					Name:        issueType["name"],
+					Description: issueType["description"],
+					Subtask:     issueType["style"] == "jira_subtask",
+				},
+				Summary:     entity["summary"],
+				Description: entity["description"],
+				Environment: entity["environment"],
+				Unknowns:    make(map[string]interface{}),
+			},
+		}
+		issues[issue.ID] = issue
+		if entity["project"] != project["id"] {
+			continue
+		}
+
+		fields := issue.Fields
+		fields.Assignee = user(entity["assignee"])
+		fields.Reporter = user(entity["reporter"])
+		fields.Creator = user(entity["creator"])
+		if status, ok := statuses[entity["status"]]; ok {
+			fields.Status = &jira.Status{ID: status["id"], Name: status["name"], Description: status["description"]}
+			if !usedStatuses[status["id"]] {
+				usedStatuses[status["id"]] = true
+				archive.Statuses = append(archive.Statuses, *fields.Status)
+			}
+		}
+		if resolution, ok := resolutions[entity["resolution"]]; ok {
+			fields.Resolution = &jira.Resolution{ID: resolution["id"], Name: resolution["name"], Description: resolution["description"]}
+		}
+		if priority, ok := priorities[entity["priority"]]; ok {
+			fields.Priority = &jira.Priority{ID: priority["id"], Name: priority["name"], Description: priority["description"]}
+		}
+		if t := backupTime(entity["created"]); t != nil {
+			fields.Created = *t
+		}
+		if t := backupTime(entity["updated"]); t != nil {
+			fields.Updated = *t
+		}
+		if t := backupTime(entity["resolutiondate"]); t != nil {
+			fields.Resolutiondate = *t
+		}
+		if t, ok := parseBackupTime(entity["duedate"]); ok {
+			fields.Duedate = jira.Date(t)
+		}
+		fields.TimeOriginalEstimate, _ = strconv.Atoi(entity["timeoriginalestimate"])
+		fields.TimeEstimate, _ = strconv.Atoi(entity["timeestimate"])
+		fields.TimeSpent, _ = strconv.Atoi(entity["timespent"])
+		fields.Comments = &jira.Comments{Comments: []*jira.Comment{}}
+		fields.Worklog = &jira.Worklog{Worklogs: []jira.WorklogRecord{}}
+		issue.Changelog = &jira.Changelog{Histories: []jira.ChangelogHistory{}}
+
+		exported = append(exported, issue)
+		exportedByID[issue.ID] = issue
+	}
+	inProject := func(issueID string) (*jira.Issue, bool) {
+		issue, ok := exportedByID[issueID]
+		return issue, ok
+	}
+
+	//* Comments
+	for _, action := range entities["Action"] {
+		issue, ok := inProject(action["issue"])
+		if !ok || action["type"] != "comment" {
+			continue
+		}
+		comment := &jira.Comment{
+			ID:      action["id"],
+			Body:    action["body"],
+			Created: formatBackupTime(action["created"]),
+			Updated: formatBackupTime(action["updated"]),
+		}
+		if author := user(action["author"]); author != nil {
+			comment.Author = *author
+		}
+		issue.Fields.Comments.Comments = append(issue.Fields.Comments.Comments, comment)
+	}
+
+	//* Attachments
+	for _, attachment := range entities["FileAttachment"] {
+		issue, ok := inProject(attachment["issue"])
+		if !ok {
+			continue
+		}
+		size, _ := strconv.Atoi(attachment["filesize"])
+		issue.Fields.Attachments = append(issue.Fields.Attachments, &jira.Attachment{
+			ID:       attachment["id"],
+			Filename: attachment["filename"],
+			Author:   user(attachment["author"]),
+			Created:  formatBackupTime(attachment["created"]),
+			Size:     size,
+			MimeType: attachment["mimetype"],
+		})
+	}
+
+	//* Fix versions and components
+	for _, association := range entities["NodeAssociation"] {
+		issue, ok := inProject(association["sourceNodeId"])
+		if !ok || association["sourceNodeEntity"] != "Issue" {
+			continue
+		}
+		switch association["associationType"] {
+		case "IssueFixVersion":
+			if version, ok := versionsByID[association["sinkNodeId"]]; ok {
+				issue.Fields.FixVersions = append(issue.Fields.FixVersions, &jira.FixVersion{ID: version["id"], Name: version["name"]})
+			}
+		case "IssueComponent":
+			if component, ok := components[association["sinkNodeId"]]; ok {
+				issue.Fields.Components = append(issue.Fields.Components, &jira.Component{ID: component["id"], Name: component["name"], Description: component["description"]})
+			}
+		}
+	}
+
+	//* Labels, the labels of custom fields have a field ID
+	for _, label := range entities["Label"] {
+		if issue, ok := inProject(label["issue"]); ok && label["fieldid"] == "" {
+			issue.Fields.Labels = append(issue.Fields.Labels, label["label"])
+		}
+	}
+
+	//* Worklogs
+	for _, worklog := range entities["Worklog"] {
+		issue, ok := inProject(worklog["issue"])
+		if !ok {
+			continue
+		}
+		seconds, _ := strconv.Atoi(worklog["timeworked"])
+		issue.Fields.Worklog.Worklogs = append(issue.Fields.Worklog.Worklogs, jira.WorklogRecord{
+			ID:               worklog["id"],
+			IssueID:          worklog["issue"],
+			Author:           user(worklog["author"]),
+			Comment:          worklog["body"],
+			Created:          backupTime(worklog["created"]),
+			Started:          backupTime(worklog["startdate"]),
+			TimeSpentSeconds: seconds,
+		})
+	}
+	for _, issue := range exported {
+		issue.Fields.Worklog.Total = len(issue.Fields.Worklog.Worklogs)
+		issue.Fields.Worklog.MaxResults = len(issue.Fields.Worklog.Worklogs)
+	}
+
+	//* Changelog
+	changeGroups := make(map[string]int)
+	changeIssues := make(map[string]*jira.Issue)
+	for _, group := range entities["ChangeGroup"] {
+		issue, ok := inProject(group["issue"])
+		if !ok {
+			continue
+		}
+		history := jira.ChangelogHistory{
+			Id:      group["id"],
+			Created: formatBackupTime(group["created"]),
+		}
+		if author := user(group["author"]); author != nil {
+			history.Author = *author
+		}
+		changeGroups[group["id"]] = len(issue.Changelog.Histories)
+		changeIssues[group["id"]] = issue
+		issue.Changelog.Histories = append(issue.Changelog.Histories, history)
+	}
+	for _, item := range entities["ChangeItem"] {
+		issue, ok := changeIssues[item["group"]]
+		if !ok {
+			continue
+		}
+		history := &issue.Changelog.Histories[changeGroups[item["group"]]]
+		history.Items = append(history.Items, jira.ChangelogItems{
+			Field:      item["field"],
+			FieldType:  item["fieldtype"],
+			From:       item["oldvalue"],
+			FromString: item["oldstring"],
+			To:         item["newvalue"],
+			ToString:   item["newstring"],
+		})
+	}
+	for _, issue := range exported {
+		sort.SliceStable(issue.Changelog.Histories, func(i, j int) bool {
+			return issue.Changelog.Histories[i].Created < issue.Changelog.Histories[j].Created
+		})
+	}
+
+	//* Links, the sub-task and epic links are parents
+	linkTypes := byID("IssueLinkType")
+	stub := func(issue *jira.Issue) *jira.Issue {
+		return &jira.Issue{ID: issue.ID, Key: issue.Key, Fields: &jira.IssueFields{Type: issue.Fields.Type, Summary: issue.Fields.Summary}}
+	}
+	for _, link := range entities["IssueLink"] {
+		source, sourceOK := issues[link["source"]]
+		destination, destinationOK := issues[link["destination"]]
+		linkType, linkTypeOK := linkTypes[link["linktype"]]
+		if !sourceOK || !destinationOK || !linkTypeOK {
+			continue
+		}
+
+		switch {
+		case linkType["style"] == "jira_subtask" || linkType["style"] == "jira_gh_epic_story" || linkType["linkname"] == "Epic-Story Link":
+			if _, ok := inProject(destination.ID); ok && destination.Fields.Parent == nil {
+				destination.Fields.Parent = &jira.Parent{ID: source.ID, Key: source.Key}
+			}
+		default:
+			issueLinkType := jira.IssueLinkType{ID: linkType["id"], Name: linkType["linkname"], Inward: linkType["inward"], Outward: linkType["outward"]}
+			if _, ok := inProject(source.ID); ok {
+				source.Fields.IssueLinks = append(source.Fields.IssueLinks, &jira.IssueLink{ID: link["id"], Type: issueLinkType, OutwardIssue: stub(destination)})
+			}
+			if _, ok := inProject(destination.ID); ok {
+				destination.Fields.IssueLinks = append(destination.Fields.IssueLinks, &jira.IssueLink{ID: link["id"], Type: issueLinkType, InwardIssue: stub(source)})
+			}
+		}
+	}
+
+	//* Custom fields, by customfield_<ID> as in the REST API
+	customFields := byID("CustomField")
+	for _, value := range entities["CustomFieldValue"] {
+		issue, ok := inProject(value["issue"])
+		if !ok {
+			continue
+		}
+		customField := customFields[value["customfield"]]
+		key := fmt.Sprintf("customfield_%s", value["customfield"])
+
+		var v interface{}
+		switch {
+		case strings.HasSuffix(customField["customfieldtypekey"], ":gh-epic-link"):
+			//* The epic link is the ID of the epic
+			epicID := value["numbervalue"]
+			if i := strings.Index(epicID, "."); i > 0 {
+				epicID = epicID[:i]
+			}
+			epic, ok := issues[epicID]
+			if !ok {
+				continue
+			}
+			v = epic.Key
+			if issue.Fields.Parent == nil {
+				issue.Fields.Parent = &jira.Parent{ID: epic.ID, Key: epic.Key}
+			}
+		case strings.HasSuffix(customField["customfieldtypekey"], ":gh-sprint"):
+			//* The sprints are not in entities.xml
+			continue
+		case value["numbervalue"] != "":
+			v, _ = strconv.ParseFloat(value["numbervalue"], 64)
+		case value["datevalue"] != "":
+			v = backupDate(value["datevalue"])
+		case value["textvalue"] != "":
+			v = value["textvalue"]
+		default:
+			v = value["stringvalue"]
+		}
+
+		//* Multiple values are lists
+		switch existing := issue.Fields.Unknowns[key].(type) {
+		case nil:
+			issue.Fields.Unknowns[key] = v
+		case []interface{}:
+			issue.Fields.Unknowns[key] = append(existing, v)
+		default:
+			issue.Fields.Unknowns[key] = []interface{}{existing, v}
+		}
+	}
+
+	//* Epics and issues, ordered by key
+	sortIssuesByKey(exported)
+	for _, issue := range exported {
+		if issue.Fields.Type.Name == "Epic" {
+			archive.Epics = append(archive.Epics, issue)
+		} else {
+			archive.Issues = append(archive.Issues, issue)
+		}
+	}
+
+	return archive, nil
+}
+
+// sortIssuesByKey sorts the issues by the number of their key, as Order by key ASC
+func sortIssuesByKey(issues []*jira.Issue) {
+	number := func(key string) int {
+		n, _ := strconv.Atoi(key[strings.LastIndex(key, "-")+1:])
+		return n
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		return number(issues[i].Key) < number(issues[j].Key)
+	})
+}
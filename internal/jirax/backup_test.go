@@ -0,0 +1,92 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package jirax
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertBackupEntities(t *testing.T) {
+	entities, err := readBackupEntities(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<entity-engine-xml>
+    <Project id="10000" name="Self Service" key="SSP" lead="JIRAUSER10000"/>
+    <Project id="10001" name="Other" key="OTH"/>
+    <ApplicationUser id="1" userKey="JIRAUSER10000" lowerUserName="jeff"/>
+    <User id="1" userName="jeff" displayName="Jeff" emailAddress="jeff@infograb.net" active="1"/>
+    <IssueType id="1" name="Bug"/>
+    <IssueType id="2" name="Epic"/>
+    <IssueType id="3" name="Sub-task" style="jira_subtask"/>
+    <Status id="1" name="Open"/>
+    <Version id="1" project="10000" name="1.0" sequence="2" releasedate="2023-02-01 00:00:00.0"/>
+    <Version id="2" project="10000" name="0.9" sequence="1"/>
+    <Issue id="1" project="10000" number="2" type="2" status="1" summary="Epic" reporter="JIRAUSER10000" created="2023-01-02 10:00:00.0"/>
+    <Issue id="2" project="10000" number="10" type="1" status="1" summary="Bug" assignee="JIRAUSER10000" duedate="2023-01-31 00:00:00.0">
+        <description><![CDATA[*Bold*]]></description>
+    </Issue>
+    <Issue id="3" project="10000" number="11" type="3" status="1" summary="Sub-task"/>
+    <Issue id="4" project="10001" number="1" type="1" summary="Other"/>
+    <Action id="1" issue="2" type="comment" author="JIRAUSER10000" created="2023-01-03 10:00:00.0" body="Comment"/>
+    <FileAttachment id="100" issue="2" filename="log.txt" created="2023-01-03 10:00:00.0" author="JIRAUSER10000"/>
+    <NodeAssociation sourceNodeId="2" sourceNodeEntity="Issue" sinkNodeId="1" sinkNodeEntity="Version" associationType="IssueFixVersion"/>
+    <Label id="1" issue="2" label="backend"/>
+    <Worklog id="1" issue="2" author="JIRAUSER10000" startdate="2023-01-03 09:00:00.0" timeworked="3600"/>
+    <ChangeGroup id="1" issue="2" author="JIRAUSER10000" created="2023-01-03 11:00:00.0"/>
+    <ChangeItem id="1" group="1" fieldtype="jira" field="status" oldstring="Open" newstring="Done"/>
+    <IssueLinkType id="1" linkname="Blocks" inward="is blocked by" outward="blocks"/>
+    <IssueLinkType id="2" linkname="jira_subtask_link" style="jira_subtask"/>
+    <IssueLink id="1" linktype="1" source="2" destination="4"/>
+    <IssueLink id="2" linktype="2" source="2" destination="3"/>
+    <CustomField id="10100" name="Epic Link" customfieldtypekey="com.pyxis.greenhopper.jira:gh-epic-link"/>
+    <CustomField id="10101" name="Story Points" customfieldtypekey="com.atlassian.jira.plugin.system.customfieldtypes:float"/>
+    <CustomFieldValue id="1" issue="2" customfield="10100" numbervalue="1.0"/>
+    <CustomFieldValue id="2" issue="2" customfield="10101" numbervalue="3.0"/>
+    <OSPropertyEntry id="1" entityName="ignored"/>
+</entity-engine-xml>`))
+	require.NoError(t, err)
+
+	archive, err := convertBackupEntities(entities, "ssp")
+	require.NoError(t, err)
+
+	assert.Equal(t, "SSP", archive.Project.Key)
+	assert.Equal(t, "jeff", archive.Project.Lead.Name)
+	assert.Equal(t, []string{"0.9", "1.0"}, []string{archive.Project.Versions[0].Name, archive.Project.Versions[1].Name})
+	assert.Equal(t, "2023-02-01", archive.Project.Versions[1].ReleaseDate)
+
+	require.Len(t, archive.Epics, 1)
+	assert.Equal(t, "SSP-2", archive.Epics[0].Key)
+
+	require.Len(t, archive.Issues, 2)
+	bug := archive.Issues[0]
+	assert.Equal(t, "SSP-10", bug.Key)
+	assert.Equal(t, "*Bold*", bug.Fields.Description)
+	assert.Equal(t, "Jeff", bug.Fields.Assignee.DisplayName)
+	assert.Equal(t, "Open", bug.Fields.Status.Name)
+	assert.Equal(t, "2023-01-03T10:00:00.000+0000", bug.Fields.Comments.Comments[0].Created)
+	assert.Equal(t, "log.txt", bug.Fields.Attachments[0].Filename)
+	assert.Equal(t, "1.0", bug.Fields.FixVersions[0].Name)
+	assert.Equal(t, []string{"backend"}, bug.Fields.Labels)
+	assert.Equal(t, 3600, bug.Fields.Worklog.Worklogs[0].TimeSpentSeconds)
+	assert.Equal(t, "Done", bug.Changelog.Histories[0].Items[0].ToString)
+	assert.Equal(t, "OTH-1", bug.Fields.IssueLinks[0].OutwardIssue.Key)
+	assert.Equal(t, "Blocks", bug.Fields.IssueLinks[0].Type.Name)
+	assert.Equal(t, "SSP-2", bug.Fields.Parent.Key)
+	assert.Equal(t, "SSP-2", bug.Fields.Unknowns["customfield_10100"])
+	assert.Equal(t, 3.0, bug.Fields.Unknowns["customfield_10101"])
+
+	assert.Equal(t, "SSP-10", archive.Issues[1].Fields.Parent.Key)
+
+	_, err = convertBackupEntities(entities, "NONE")
+	assert.Error(t, err)
+}
@@ -0,0 +1,142 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package jirax
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+)
+
+//* Jira Cloud REST API v3 returns the rich text fields in the Atlassian Document Format (ADF).
+// The ADF documents are kept as JSON strings in the string fields of jira.Issue,
+// so that the issues of Jira Cloud and Jira Server are handled the same way.
+
+type cloudSearchResult struct {
+	Issues        []json.RawMessage `json:"issues"`
+	NextPageToken string            `json:"nextPageToken"`
+	IsLast        bool              `json:"isLast"`
+}
+
+// UnpaginateCloudIssue is UnpaginateIssue for Jira Cloud, with the enhanced search of REST API v3.
+func UnpaginateCloudIssue(
+	jr *jira.Client,
+	jql string,
+	expand ...string,
+) ([]*jira.Issue, error) {
+
+	var result []*jira.Issue
+
+	q := url.Values{}
+	q.Set("jql", jql)
+	q.Set("maxResults", "100")
+	q.Set("fields", "*all")
+	if len(expand) > 0 {
+		q.Set("expand", strings.Join(expand, ","))
+	}
+
+	for {
+		req, err := jr.NewRequest(context.Background(), http.MethodGet, "rest/api/3/search/jql?"+q.Encode(), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating request")
+		}
+
+		page := new(cloudSearchResult)
+		if _, err := jr.Do(req, page); err != nil {
+			return nil, errors.Wrap(err, "Error getting Jira issues V3")
+		}
+
+		for _, raw := range page.Issues {
+			issue, err := decodeCloudIssue(raw)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error decoding Jira issue V3")
+			}
+			result = append(result, issue)
+		}
+
+		if page.IsLast || page.NextPageToken == "" {
+			break
+		}
+
+		q.Set("nextPageToken", page.NextPageToken)
+	}
+
+	return result, nil
+}
+
+func decodeCloudIssue(raw json.RawMessage) (*jira.Issue, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	if fields, ok := data["fields"].(map[string]interface{}); ok {
+		for _, key := range []string{"description", "environment"} {
+			if err := stringifyADF(fields, key); err != nil {
+				return nil, err
+			}
+		}
+
+		if comment, ok := fields["comment"].(map[string]interface{}); ok {
+			comments, _ := comment["comments"].([]interface{})
+			for _, c := range comments {
+				if c, ok := c.(map[string]interface{}); ok {
+					if err := stringifyADF(c, "body"); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		if worklog, ok := fields["worklog"].(map[string]interface{}); ok {
+			worklogs, _ := worklog["worklogs"].([]interface{})
+			for _, w := range worklogs {
+				if w, ok := w.(map[string]interface{}); ok {
+					if err := stringifyADF(w, "comment"); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	normalized, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	issue := new(jira.Issue)
+	if err := json.Unmarshal(normalized, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// stringifyADF replaces the ADF document of the key with its JSON string
+func stringifyADF(m map[string]interface{}, key string) error {
+	doc, ok := m[key].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	value, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "Error marshalling ADF document")
+	}
+	m[key] = string(value)
+	return nil
+}
@@ -0,0 +1,413 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package jirax
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+)
+
+// A Jira CSV export is the "Export CSV (all fields)" of the issue search.
+// The fields with several values are repeated columns with the same header, e.g. Comment or Attachment.
+// - Comment: <Created>;<Author>;<Body>
+// - Log Work: <Comment>;<Started>;<Author>;<Seconds>
+// - Attachment: <Created>;<Author>;<Filename>;<URL>
+// The custom fields are named "Custom field (<Name>)" and are read by their name.
+
+var (
+	csvAttachmentIDRegex = regexp.MustCompile(`/attachment/(\d+)/`)
+	csvLinkRegex         = regexp.MustCompile(`^(Inward|Outward) issue link \((.+)\)$`)
+	csvCustomFieldRegex  = regexp.MustCompile(`^Custom field \((.+)\)$`)
+)
+
+// The dates are in the date format of the exporting user
+var (
+	csvTimeLayouts = []string{"02/Jan/06 3:04 PM", "2/Jan/06 3:04 PM", "02/Jan/06 15:04", "2006-01-02 15:04", "2006-01-02 15:04:05", jiraTimeLayout}
+	csvDateLayouts = []string{"02/Jan/06", "2/Jan/06", "2006-01-02"}
+)
+
+func parseCSVTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range append(append([]string{}, csvTimeLayouts...), csvDateLayouts...) {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func parseCSVDate(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range csvDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+// csvRow reads the columns of a row by header
+type csvRow struct {
+	header map[string][]int
+	values []string
+}
+
+func (r *csvRow) get(name string) string {
+	for _, i := range r.header[name] {
+		if i < len(r.values) && r.values[i] != "" {
+			return r.values[i]
+		}
+	}
+	return ""
+}
+
+// first returns the first value of the headers, the headers differ between Jira versions
+func (r *csvRow) first(names ...string) string {
+	for _, name := range names {
+		if value := r.get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (r *csvRow) all(names ...string) []string {
+	result := []string{}
+	for _, name := range names {
+		for _, i := range r.header[name] {
+			if i < len(r.values) && r.values[i] != "" {
+				result = append(result, r.values[i])
+			}
+		}
+	}
+	return result
+}
+
+// OpenCSVExport reads the issues of the Jira project from a CSV export with all fields.
+// The attachment files are found in the attachments directory, named after their Jira attachment ID.
+func OpenCSVExport(csvPath string, attachmentsDir string, projectKey string) (*ArchiveSource, error) {
+	file, err := os.Open(csvPath)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error opening Jira CSV export: %s", csvPath))
+	}
+	defer file.Close()
+
+	archive, err := readCSVExport(file, projectKey)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error reading Jira CSV export: %s", csvPath))
+	}
+
+	if err := resolveAttachments(archive, attachmentsDir); err != nil {
+		return nil, errors.Wrap(err, "Error resolving attachments")
+	}
+
+	s := &ArchiveSource{Archive: archive, dir: attachmentsDir, origin: absPath(csvPath)}
+	s.indexIssues()
+	return s, nil
+}
+
+func readCSVExport(r io.Reader, projectKey string) (*Archive, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing CSV")
+	}
+	if len(records) == 0 {
+		return nil, errors.New("Empty CSV export")
+	}
+
+	header := make(map[string][]int)
+	for i, name := range records[0] {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		header[name] = append(header[name], i)
+	}
+	if _, ok := header["Issue key"]; !ok {
+		return nil, errors.New("No Issue key column, the CSV export must have all fields")
+	}
+
+	archive := NewArchive("", "server")
+	archive.Project = &jira.Project{Key: strings.ToUpper(projectKey)}
+
+	users := make(map[string]*jira.User)
+	user := func(name string) *jira.User {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil
+		}
+		if result, ok := users[name]; ok {
+			return result
+		}
+		result := &jira.User{Key: name, Name: name, DisplayName: name}
+		users[name] = result
+		archive.Users = append(archive.Users, result)
+		return result
+	}
+	jiraTime := func(value string) *jira.Time {
+		if t, ok := parseCSVTime(value); ok {
+			result := jira.Time(t)
+			return &result
+		}
+		return nil
+	}
+	formatTime := func(value string) string {
+		if t, ok := parseCSVTime(value); ok {
+			return t.Format(jiraTimeLayout)
+		}
+		return ""
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := []*csvRow{}
+	issueTypes := make(map[string]jira.IssueType)
+	issueKeys := make(map[string]string)
+	for _, values := range records[1:] {
+		row := &csvRow{header: header, values: values}
+		key := row.get("Issue key")
+		if key == "" {
+			continue
+		}
+		issueTypes[key] = jira.IssueType{Name: row.get("Issue Type")}
+		issueKeys[row.get("Issue id")] = key
+
+		//* The export can contain the issues of several projects
+		if project := row.get("Project key"); project != "" {
+			if !strings.EqualFold(project, projectKey) {
+				continue
+			}
+		} else if !strings.HasPrefix(key, archive.Project.Key+"-") {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, errors.Errorf("No issue of Jira project %s in the CSV export", projectKey)
+	}
+
+	versions := make(map[string]bool)
+	usedStatuses := make(map[string]bool)
+	issues := []*jira.Issue{}
+	for _, row := range rows {
+		key := row.get("Issue key")
+
+		//* Project
+		if archive.Project.Name == "" {
+			archive.Project.ID = row.get("Project id")
+			archive.Project.Name = row.get("Project name")
+			archive.Project.Description = row.get("Project description")
+			if lead := user(row.get("Project lead")); lead != nil {
+				archive.Project.Lead = *lead
+			}
+		}
+
+		fields := &jira.IssueFields{
+			Type:        issueTypes[key],
+			Summary:     row.get("Summary"),
+			Description: row.get("Description"),
+			Environment: row.get("Environment"),
+			Assignee:    user(row.get("Assignee")),
+			Reporter:    user(row.get("Reporter")),
+			Creator:     user(row.get("Creator")),
+			Labels:      row.all("Labels"),
+			Comments:    &jira.Comments{Comments: []*jira.Comment{}},
+			Worklog:     &jira.Worklog{Worklogs: []jira.WorklogRecord{}},
+			Unknowns:    make(map[string]interface{}),
+		}
+		issue := &jira.Issue{ID: row.get("Issue id"), Key: key, Fields: fields}
+
+		if status := row.get("Status"); status != "" {
+			fields.Status = &jira.Status{Name: status}
+			if !usedStatuses[status] {
+				usedStatuses[status] = true
+				archive.Statuses = append(archive.Statuses, *fields.Status)
+			}
+		}
+		if resolution := row.get("Resolution"); resolution != "" {
+			fields.Resolution = &jira.Resolution{Name: resolution}
+		}
+		if priority := row.get("Priority"); priority != "" {
+			fields.Priority = &jira.Priority{Name: priority}
+		}
+		if t := jiraTime(row.get("Created")); t != nil {
+			fields.Created = *t
+		}
+		if t := jiraTime(row.get("Updated")); t != nil {
+			fields.Updated = *t
+		}
+		if t := jiraTime(row.get("Resolved")); t != nil {
+			fields.Resolutiondate = *t
+		}
+		if t, ok := parseCSVTime(row.first("Due Date", "Due date")); ok {
+			fields.Duedate = jira.Date(t)
+		}
+		fields.TimeOriginalEstimate, _ = strconv.Atoi(row.get("Original Estimate"))
+		fields.TimeEstimate, _ = strconv.Atoi(row.get("Remaining Estimate"))
+		fields.TimeSpent, _ = strconv.Atoi(row.get("Time Spent"))
+
+		//* Versions
+		for _, name := range row.all("Fix Version/s", "Fix versions") {
+			fields.FixVersions = append(fields.FixVersions, &jira.FixVersion{Name: name})
+			if !versions[name] {
+				versions[name] = true
+				archive.Project.Versions = append(archive.Project.Versions, jira.Version{Name: name})
+			}
+		}
+		for _, name := range row.all("Component/s", "Components") {
+			fields.Components = append(fields.Components, &jira.Component{Name: name})
+		}
+
+		//* Parent, the parent ID of sub-tasks or the epic link
+		if parentKey, ok := issueKeys[row.get("Parent id")]; ok {
+			fields.Parent = &jira.Parent{ID: row.get("Parent id"), Key: parentKey}
+		} else if parent := row.get("Parent"); parent != "" {
+			if parentKey, ok := issueKeys[parent]; ok {
+				parent = parentKey
+			}
+			fields.Parent = &jira.Parent{Key: parent}
+		} else if epic := row.get("Custom field (Epic Link)"); epic != "" {
+			if epicKey, ok := issueKeys[epic]; ok {
+				epic = epicKey
+			}
+			fields.Parent = &jira.Parent{Key: epic}
+		}
+
+		//* Comments
+		for i, value := range row.all("Comment") {
+			parts := strings.SplitN(value, ";", 3)
+			if len(parts) < 3 {
+				continue
+			}
+			comment := &jira.Comment{
+				ID:      fmt.Sprintf("%s-%d", key, i+1),
+				Created: formatTime(parts[0]),
+				Body:    parts[2],
+			}
+			if author := user(parts[1]); author != nil {
+				comment.Author = *author
+			}
+			fields.Comments.Comments = append(fields.Comments.Comments, comment)
+		}
+
+		//* Worklogs, the comment can contain semicolons
+		for i, value := range row.all("Log Work") {
+			parts := strings.Split(value, ";")
+			if len(parts) < 4 {
+				continue
+			}
+			n := len(parts)
+			seconds, _ := strconv.Atoi(strings.TrimSpace(parts[n-1]))
+			fields.Worklog.Worklogs = append(fields.Worklog.Worklogs, jira.WorklogRecord{
+				ID:               fmt.Sprintf("%s-%d", key, i+1),
+				IssueID:          issue.ID,
+				Author:           user(parts[n-2]),
+				Comment:          strings.Join(parts[:n-3], ";"),
+				Started:          jiraTime(parts[n-3]),
+				TimeSpentSeconds: seconds,
+			})
+		}
+		fields.Worklog.Total = len(fields.Worklog.Worklogs)
+		fields.Worklog.MaxResults = len(fields.Worklog.Worklogs)
+
+		//* Attachments, the filename can contain semicolons
+		for _, value := range row.all("Attachment") {
+			parts := strings.Split(value, ";")
+			if len(parts) < 4 {
+				continue
+			}
+			url := parts[len(parts)-1]
+			match := csvAttachmentIDRegex.FindStringSubmatch(url)
+			if match == nil {
+				continue
+			}
+			fields.Attachments = append(fields.Attachments, &jira.Attachment{
+				ID:       match[1],
+				Filename: strings.Join(parts[2:len(parts)-1], ";"),
+				Author:   user(parts[1]),
+				Created:  formatTime(parts[0]),
+				Content:  url,
+			})
+		}
+
+		for _, name := range names {
+			//* Links
+			if match := csvLinkRegex.FindStringSubmatch(name); match != nil {
+				for _, targetKey := range row.all(name) {
+					target := &jira.Issue{Key: targetKey, Fields: &jira.IssueFields{Type: issueTypes[targetKey]}}
+					link := &jira.IssueLink{Type: jira.IssueLinkType{Name: match[2]}}
+					if match[1] == "Outward" {
+						link.OutwardIssue = target
+					} else {
+						link.InwardIssue = target
+					}
+					fields.IssueLinks = append(fields.IssueLinks, link)
+				}
+				continue
+			}
+
+			//* Custom fields by name, numbers and dates as in the REST API
+			if match := csvCustomFieldRegex.FindStringSubmatch(name); match != nil {
+				values := []interface{}{}
+				for _, value := range row.all(name) {
+					if number, err := strconv.ParseFloat(value, 64); err == nil {
+						values = append(values, number)
+					} else if date, ok := parseCSVDate(value); ok {
+						values = append(values, date)
+					} else {
+						values = append(values, value)
+					}
+				}
+				switch {
+				case len(values) == 1:
+					fields.Unknowns[match[1]] = values[0]
+				case len(values) > 1:
+					fields.Unknowns[match[1]] = values
+				}
+			}
+		}
+
+		//* The epic link is the key of the epic, as in the REST API
+		if _, ok := fields.Unknowns["Epic Link"]; ok && fields.Parent != nil {
+			fields.Unknowns["Epic Link"] = fields.Parent.Key
+		}
+
+		issues = append(issues, issue)
+	}
+
+	//* Epics and issues, ordered by key
+	sortIssuesByKey(issues)
+	for _, issue := range issues {
+		if issue.Fields.Type.Name == "Epic" {
+			archive.Epics = append(archive.Epics, issue)
+		} else {
+			archive.Issues = append(archive.Issues, issue)
+		}
+	}
+
+	return archive, nil
+}
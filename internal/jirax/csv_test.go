@@ -0,0 +1,56 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package jirax
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCSVExport(t *testing.T) {
+	archive, err := readCSVExport(strings.NewReader(
+		"Summary,Issue key,Issue id,Parent id,Issue Type,Status,Project key,Assignee,Created,Fix Version/s,Fix Version/s,Labels,Description,Log Work,Comment,Comment,Attachment,Outward issue link (Blocks),Custom field (Epic Link),Custom field (Story Points)\n"+
+			"Epic,SSP-2,10001,,Epic,Open,SSP,,02/Jan/23 10:00 AM,,,,,,,,,,,\n"+
+			"Bug,SSP-10,10002,,Bug,Open,SSP,jeff,03/Jan/23 2:30 PM,0.9,1.0,backend,\"*Bold*\",Fixed it;03/Jan/23 9:00 AM;jeff;3600,03/Jan/23 10:00 AM;jeff;First; with semicolon,04/Jan/23 10:00 AM;jeff;Second,03/Jan/23 10:00 AM;jeff;log.txt;https://jira.infograb.net/secure/attachment/100/log.txt,SSP-11,SSP-2,3\n"+
+			"Sub-task,SSP-11,10003,10002,Sub-task,Done,SSP,,03/Jan/23 10:00 AM,,,,,,,,,,,\n"+
+			"Other,OTH-1,10004,,Bug,Open,OTH,,03/Jan/23 10:00 AM,,,,,,,,,,,\n",
+	), "SSP")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"0.9", "1.0"}, []string{archive.Project.Versions[0].Name, archive.Project.Versions[1].Name})
+
+	require.Len(t, archive.Epics, 1)
+	assert.Equal(t, "SSP-2", archive.Epics[0].Key)
+
+	require.Len(t, archive.Issues, 2)
+	bug := archive.Issues[0]
+	assert.Equal(t, "SSP-10", bug.Key)
+	assert.Equal(t, "*Bold*", bug.Fields.Description)
+	assert.Equal(t, "jeff", bug.Fields.Assignee.Name)
+	assert.Equal(t, "2023-01-03 14:30", time.Time(bug.Fields.Created).Format("2006-01-02 15:04"))
+	assert.Equal(t, []string{"backend"}, bug.Fields.Labels)
+	assert.Equal(t, "First; with semicolon", bug.Fields.Comments.Comments[0].Body)
+	assert.Equal(t, "2023-01-03T10:00:00.000+0000", bug.Fields.Comments.Comments[0].Created)
+	assert.Equal(t, "Fixed it", bug.Fields.Worklog.Worklogs[0].Comment)
+	assert.Equal(t, 3600, bug.Fields.Worklog.Worklogs[0].TimeSpentSeconds)
+	assert.Equal(t, "100", bug.Fields.Attachments[0].ID)
+	assert.Equal(t, "log.txt", bug.Fields.Attachments[0].Filename)
+	assert.Equal(t, "SSP-11", bug.Fields.IssueLinks[0].OutwardIssue.Key)
+	assert.Equal(t, "Sub-task", bug.Fields.IssueLinks[0].OutwardIssue.Fields.Type.Name)
+	assert.Equal(t, "SSP-2", bug.Fields.Parent.Key)
+	assert.Equal(t, 3.0, bug.Fields.Unknowns["Story Points"])
+
+	assert.Equal(t, "SSP-10", archive.Issues[1].Fields.Parent.Key)
+}
@@ -13,14 +13,17 @@ package jirax
 
 import (
 	"context"
+	"strings"
 
 	jira "github.com/andygrunwald/go-jira/v2/onpremise"
 	"github.com/pkg/errors"
 )
 
+// The expand values are added to the search, e.g. "changelog" to get the change history of the issues.
 func UnpaginateIssue(
 	jr *jira.Client,
 	jql string,
+	expand ...string,
 ) ([]*jira.Issue, error) {
 
 	var result []*jira.Issue
@@ -29,6 +32,7 @@ func UnpaginateIssue(
 		StartAt:    0,
 		MaxResults: 100,
 		Fields:     []string{"*all"},
+		Expand:     strings.Join(expand, ","),
 	}
 
 	for {
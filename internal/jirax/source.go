@@ -0,0 +1,111 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package jirax
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+)
+
+// Source is where the conversion reads the Jira project from, the Jira site or an exported archive
+type Source interface {
+	//* The project with its versions
+	GetProject(projectKey string) (*jira.Project, error)
+
+	//* The epics and the other issues of the project matching the JQL, ordered by key
+	GetIssues(projectKey string, jql string, expand ...string) ([]*jira.Issue, []*jira.Issue, error)
+
+	GetWorklogs(issueKey string) ([]jira.WorklogRecord, error)
+	GetSprints(boardID int) ([]*jira.Sprint, error)
+	DownloadAttachment(attachment *jira.Attachment) (io.ReadCloser, error)
+
+	//* The Jira site or file the attachment IDs belong to, the attachment cache is shared by every source
+	Origin() string
+}
+
+// ClientSource reads the Jira project from the Jira site
+type ClientSource struct {
+	jr    *jira.Client
+	cloud bool
+}
+
+func NewClientSource(jr *jira.Client, cloud bool) *ClientSource {
+	return &ClientSource{jr: jr, cloud: cloud}
+}
+
+func (s *ClientSource) GetProject(projectKey string) (*jira.Project, error) {
+	project, _, err := s.jr.Project.Get(context.Background(), projectKey)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting Jira project: %s", projectKey))
+	}
+	return project, nil
+}
+
+func (s *ClientSource) GetIssues(projectKey string, jql string, expand ...string) ([]*jira.Issue, []*jira.Issue, error) {
+	unpaginate := UnpaginateIssue
+	if s.cloud {
+		unpaginate = UnpaginateCloudIssue
+	}
+
+	//* JQL
+	var prefixJql string
+	if jql != "" {
+		prefixJql = fmt.Sprintf("(%s) AND", jql)
+	} else {
+		prefixJql = ""
+	}
+
+	//* Get Jira Issues for Epic
+	epicJql := fmt.Sprintf("%s project = %s AND type = Epic Order by key ASC", prefixJql, projectKey)
+	jiraEpics, err := unpaginate(s.jr, epicJql, expand...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error getting Jira issues for GitLab Epics")
+	}
+
+	//* Get Jira Issues for Issue
+	issueJql := fmt.Sprintf("%s project = %s AND type != Epic Order by key ASC", prefixJql, projectKey)
+	jiraIssues, err := unpaginate(s.jr, issueJql, expand...)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Error getting Jira issues for GitLab Issues")
+	}
+
+	return jiraEpics, jiraIssues, nil
+}
+
+func (s *ClientSource) GetWorklogs(issueKey string) ([]jira.WorklogRecord, error) {
+	worklog, _, err := s.jr.Issue.GetWorklogs(context.Background(), issueKey)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting worklogs of issue %s", issueKey))
+	}
+	return worklog.Worklogs, nil
+}
+
+func (s *ClientSource) GetSprints(boardID int) ([]*jira.Sprint, error) {
+	return UnpaginateSprints(s.jr, boardID)
+}
+
+func (s *ClientSource) Origin() string {
+	return s.jr.BaseURL.Host + strings.TrimSuffix(s.jr.BaseURL.Path, "/")
+}
+
+func (s *ClientSource) DownloadAttachment(attachment *jira.Attachment) (io.ReadCloser, error) {
+	res, err := s.jr.Issue.DownloadAttachment(context.Background(), attachment.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error downloading file")
+	}
+	return res.Body, nil
+}
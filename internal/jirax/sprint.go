@@ -0,0 +1,154 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package jirax
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+)
+
+func UnpaginateSprints(jr *jira.Client, boardID int) ([]*jira.Sprint, error) {
+	var result []*jira.Sprint
+
+	options := &jira.GetAllSprintsOptions{
+		SearchOptions: jira.SearchOptions{
+			StartAt:    0,
+			MaxResults: 50,
+		},
+	}
+
+	for {
+		sprints, _, err := jr.Board.GetAllSprints(context.Background(), boardID, options)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error getting sprints of board %d", boardID))
+		}
+
+		for _, value := range sprints.Values {
+			sprint := value
+			if sprint.OriginBoardID == 0 {
+				sprint.OriginBoardID = boardID
+			}
+			result = append(result, &sprint)
+		}
+
+		if sprints.IsLast || len(sprints.Values) == 0 {
+			break
+		}
+
+		options.StartAt += len(sprints.Values)
+	}
+
+	return result, nil
+}
+
+// Jira Server returns the sprint custom field as strings:
+// com.atlassian.greenhopper.service.sprint.Sprint@14b1c359[id=1,rapidViewId=1,state=CLOSED,name=Sprint 1,startDate=...,endDate=...,completeDate=...,sequence=1,goal=]
+var sprintFieldRegex = regexp.MustCompile(`(?:\[|,)(id|rapidViewId|state|name|goal|startDate|endDate|completeDate|activatedDate|sequence|autoStartStop|synced|incompleteIssuesDestinationId)=`)
+
+type sprintField struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	State        string `json:"state"`
+	BoardID      int    `json:"boardId"`
+	RapidViewID  int    `json:"rapidViewId"`
+	StartDate    string `json:"startDate"`
+	EndDate      string `json:"endDate"`
+	CompleteDate string `json:"completeDate"`
+}
+
+// ParseSprints parses the value of the sprint custom field of an issue.
+// Both the string format of Jira Server and the object format of the newer versions are supported.
+// The sprints keep the order of the field, so the last sprint is the last one.
+func ParseSprints(value interface{}) ([]*jira.Sprint, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	result := []*jira.Sprint{}
+	for _, v := range values {
+		field := sprintField{}
+		switch v := v.(type) {
+		case string:
+			matches := sprintFieldRegex.FindAllStringSubmatchIndex(v, -1)
+			end := len(v)
+			if strings.HasSuffix(v, "]") {
+				end--
+			}
+
+			attrs := make(map[string]string)
+			for i, match := range matches {
+				valueEnd := end
+				if i+1 < len(matches) {
+					valueEnd = matches[i+1][0]
+				}
+				attrs[v[match[2]:match[3]]] = v[match[1]:valueEnd]
+			}
+
+			field.ID, _ = strconv.Atoi(attrs["id"])
+			field.RapidViewID, _ = strconv.Atoi(attrs["rapidViewId"])
+			field.Name = attrs["name"]
+			field.State = attrs["state"]
+			field.StartDate = attrs["startDate"]
+			field.EndDate = attrs["endDate"]
+			field.CompleteDate = attrs["completeDate"]
+		case map[string]interface{}:
+			raw, err := json.Marshal(v)
+			if err != nil {
+				return nil, errors.Wrap(err, "Error marshalling sprint")
+			}
+			if err := json.Unmarshal(raw, &field); err != nil {
+				return nil, errors.Wrap(err, "Error parsing sprint")
+			}
+		default:
+			return nil, errors.New(fmt.Sprintf("Unknown sprint format: %#v", v))
+		}
+
+		if field.ID == 0 {
+			return nil, errors.New(fmt.Sprintf("Sprint without ID: %#v", v))
+		}
+
+		sprint := &jira.Sprint{
+			ID:            field.ID,
+			Name:          field.Name,
+			State:         field.State,
+			OriginBoardID: field.BoardID,
+			StartDate:     parseSprintDate(field.StartDate),
+			EndDate:       parseSprintDate(field.EndDate),
+			CompleteDate:  parseSprintDate(field.CompleteDate),
+		}
+		if sprint.OriginBoardID == 0 {
+			sprint.OriginBoardID = field.RapidViewID
+		}
+
+		result = append(result, sprint)
+	}
+
+	return result, nil
+}
+
+func parseSprintDate(value string) *time.Time {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05.000Z07:00"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package jirax
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSprints(t *testing.T) {
+	sprints, err := ParseSprints([]interface{}{
+		"com.atlassian.greenhopper.service.sprint.Sprint@14b1c359[id=1,rapidViewId=3,state=CLOSED,name=Sprint 1, part 2,startDate=2023-09-04T09:00:00.000+09:00,endDate=2023-09-15T18:00:00.000+09:00,completeDate=<null>,sequence=1,goal=]",
+		map[string]interface{}{
+			"id":        2,
+			"name":      "Sprint 2",
+			"state":     "active",
+			"boardId":   3,
+			"startDate": "2023-09-18T00:00:00.000Z",
+			"endDate":   "2023-09-29T00:00:00.000Z",
+		},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, sprints, 2)
+
+	assert.Equal(t, 1, sprints[0].ID)
+	assert.Equal(t, "Sprint 1, part 2", sprints[0].Name)
+	assert.Equal(t, 3, sprints[0].OriginBoardID)
+	assert.Equal(t, "2023-09-04", sprints[0].StartDate.Format("2006-01-02"))
+	assert.Equal(t, "2023-09-15", sprints[0].EndDate.Format("2006-01-02"))
+	assert.Nil(t, sprints[0].CompleteDate)
+
+	assert.Equal(t, 2, sprints[1].ID)
+	assert.Equal(t, "Sprint 2", sprints[1].Name)
+	assert.Equal(t, 3, sprints[1].OriginBoardID)
+
+	sprints, err = ParseSprints(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, sprints)
+}
@@ -0,0 +1,55 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package jirax
+
+import (
+	"context"
+	"fmt"
+
+	jira "github.com/andygrunwald/go-jira/v2/onpremise"
+	"github.com/pkg/errors"
+)
+
+type projectIssueTypeStatuses struct {
+	ID       string        `json:"id"`
+	Name     string        `json:"name"`
+	Statuses []jira.Status `json:"statuses"`
+}
+
+// GetProjectStatuses returns the statuses used by the workflows of the project, without duplicates.
+func GetProjectStatuses(jr *jira.Client, projectKey string) ([]jira.Status, error) {
+	u := fmt.Sprintf("rest/api/2/project/%s/statuses", projectKey)
+
+	req, err := jr.NewRequest(context.Background(), "GET", u, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+
+	issueTypes := []projectIssueTypeStatuses{}
+	if _, err := jr.Do(req, &issueTypes); err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error getting statuses of project %s", projectKey))
+	}
+
+	result := []jira.Status{}
+	exists := make(map[string]bool)
+	for _, issueType := range issueTypes {
+		for _, status := range issueType.Statuses {
+			if exists[status.Name] {
+				continue
+			}
+			exists[status.Name] = true
+			result = append(result, status)
+		}
+	}
+
+	return result, nil
+}
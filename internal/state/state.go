@@ -0,0 +1,197 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The state file is a JSON lines file which records every GitLab object
+// created by a migration as soon as it exists. Each line is an Entry.
+// The file is append-only, so it also keeps the history of previous runs.
+
+type Kind string
+
+const (
+	KindEpic            Kind = "epic"             // Key: Jira issue key
+	KindIssue           Kind = "issue"            // Key: Jira issue key
+	KindMilestone       Kind = "milestone"        // Key: Jira version name
+	KindIteration       Kind = "iteration"        // Key: Jira sprint ID
+	KindAttachment      Kind = "attachment"       // Key: Jira attachment ID
+	KindGroupAttachment Kind = "group_attachment" // Key: Jira attachment ID
+	KindUpload          Kind = "upload"           // Key: project/SHA-256 of the file
+	KindGroupUpload     Kind = "group_upload"     // Key: group/SHA-256 of the file
+	KindLabel           Kind = "label"            // Key: label name
+	KindGroupLabel      Kind = "group_label"      // Key: label name
+	KindLink            Kind = "link"             // Key: Jira issue keys "<from> <to>", a link queued until both issues are migrated
+	KindLinked          Kind = "linked"           // Key: GitLab references "<from> <to>", e.g. "10#1 20#3", the queued link was created
+	KindSync            Kind = "sync"             // Key: Jira project key, Time: start of the last successful run
+	KindRollback        Kind = "rollback"         // Key: Jira project key, the entries before were deleted
+)
+
+type Entry struct {
+	Kind   Kind   `json:"kind"`
+	Key    string `json:"key"`
+	ID     int    `json:"id,omitempty"`
+	IID    int    `json:"iid,omitempty"`
+	Parent string `json:"parent,omitempty"` //* GitLab project or group which owns the object
+
+	//* Epic and issue only, created but not completely converted yet
+	Partial bool `json:"partial,omitempty"`
+
+	//* Attachment only
+	Markdown string `json:"markdown,omitempty"`
+	Alt      string `json:"alt,omitempty"`
+	URL      string `json:"url,omitempty"`
+
+	//* Link only, the Jira link type name
+	LinkType string `json:"link_type,omitempty"`
+
+	Time time.Time `json:"time"`
+}
+
+type Store struct {
+	mutex   sync.RWMutex
+	file    *os.File
+	history []*Entry
+	index   map[Kind]map[string]*Entry
+}
+
+// Open opens the state file at path, creating it if it does not exist.
+// If resume is true, the entries of previous runs are visible through Get,
+// otherwise they are only kept as history.
+func Open(path string, resume bool) (*Store, error) {
+	s := &Store{
+		index: make(map[Kind]map[string]*Entry),
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error opening state file: %s", path))
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		entry := new(Entry)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			file.Close()
+			return nil, errors.Wrap(err, fmt.Sprintf("Error parsing state file %s at line %d", path, line))
+		}
+
+		s.history = append(s.history, entry)
+		if resume {
+			s.put(entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, errors.Wrap(err, fmt.Sprintf("Error reading state file: %s", path))
+	}
+
+	s.file = file
+	return s, nil
+}
+
+func (s *Store) put(entry *Entry) {
+	//* The objects recorded before a rollback no longer exist
+	if entry.Kind == KindRollback {
+		s.index = make(map[Kind]map[string]*Entry)
+	}
+
+	if _, ok := s.index[entry.Kind]; !ok {
+		s.index[entry.Kind] = make(map[string]*Entry)
+	}
+	s.index[entry.Kind][entry.Key] = entry
+}
+
+// Get returns the latest entry recorded for the key.
+func (s *Store) Get(kind Kind, key string) (*Entry, bool) {
+	if s == nil {
+		return nil, false
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entry, ok := s.index[kind][key]
+	return entry, ok
+}
+
+// Put appends the entry to the state file and syncs it to disk.
+func (s *Store) Put(entry *Entry) error {
+	if s == nil {
+		return nil
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "Error marshalling state entry")
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrap(err, "Error writing state file")
+	}
+	if err := s.file.Sync(); err != nil {
+		return errors.Wrap(err, "Error syncing state file")
+	}
+
+	s.history = append(s.history, entry)
+	s.put(entry)
+	return nil
+}
+
+// Entries returns every entry of the kind recorded since the last rollback, including previous runs.
+func (s *Store) Entries(kind Kind) []*Entry {
+	if s == nil {
+		return nil
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := []*Entry{}
+	for _, entry := range s.history {
+		if entry.Kind == KindRollback {
+			result = []*Entry{}
+		}
+		if entry.Kind == kind {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+func (s *Store) Close() error {
+	if s == nil || s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
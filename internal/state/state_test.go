@@ -0,0 +1,99 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeEntries(t *testing.T, path string, entries ...*Entry) {
+	store, err := Open(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for _, entry := range entries {
+		if err := store.Put(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "j2lab.state.jsonl")
+	writeEntries(t, path,
+		&Entry{Kind: KindIssue, Key: "SSP-1", IID: 1, Parent: "group/project"},
+		&Entry{Kind: KindIssue, Key: "SSP-1", IID: 2, Parent: "group/project"},
+	)
+
+	//* Without resume, the previous runs are only history
+	store, err := Open(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.Get(KindIssue, "SSP-1"); ok {
+		t.Errorf("Get() without resume found an entry of a previous run")
+	}
+	if entries := store.Entries(KindIssue); len(entries) != 2 {
+		t.Errorf("Entries() = %d entries, want 2", len(entries))
+	}
+	store.Close()
+
+	//* With resume, Get returns the latest entry
+	store, err = Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if entry, ok := store.Get(KindIssue, "SSP-1"); !ok || entry.IID != 2 {
+		t.Errorf("Get() = %v, %t, want IID 2", entry, ok)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "j2lab.state.jsonl")
+	writeEntries(t, path,
+		&Entry{Kind: KindIssue, Key: "SSP-1", IID: 1},
+		&Entry{Kind: KindRollback, Key: "SSP"},
+		&Entry{Kind: KindIssue, Key: "SSP-2", IID: 2},
+	)
+
+	store, err := Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, ok := store.Get(KindIssue, "SSP-1"); ok {
+		t.Errorf("Get() found an entry recorded before the rollback")
+	}
+	if _, ok := store.Get(KindIssue, "SSP-2"); !ok {
+		t.Errorf("Get() did not find the entry recorded after the rollback")
+	}
+	if entries := store.Entries(KindIssue); len(entries) != 1 || entries[0].Key != "SSP-2" {
+		t.Errorf("Entries() = %v, want only SSP-2", entries)
+	}
+}
+
+func TestOpenMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "j2lab.state.jsonl")
+	content := "{\"kind\":\"issue\",\"key\":\"SSP-1\"}\n\n{\"kind\":\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(path, true); err == nil {
+		t.Errorf("Open() of a malformed state file did not fail")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// S3 puts the files into a bucket of an S3-compatible storage with path-style URLs, e.g. AWS S3 or MinIO.
+// The files are linked from URL, or from the bucket URL which must then be readable by the issue readers.
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	URL       string
+}
+
+func (s *S3) Put(key string, path string, sum string, contentType string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	if s.Prefix != "" {
+		key = s.Prefix + "/" + key
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Error opening file")
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", errors.Wrap(err, "Error reading file")
+	}
+
+	objectURL := fmt.Sprintf("%s/%s/%s", s.Endpoint, escapeKey(s.Bucket), escapeKey(key))
+	req, err := http.NewRequest(http.MethodPut, objectURL, file)
+	if err != nil {
+		return "", errors.Wrap(err, "Error creating request")
+	}
+	req.ContentLength = info.Size()
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", sum)
+	req.Header.Set("X-Amz-Date", time.Now().UTC().Format(amzDateLayout))
+	signV4(req, sum, s.AccessKey, s.SecretKey, s.Region)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "Error making request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", errors.New(fmt.Sprintf("Error putting %s: %s %s", key, resp.Status, strings.TrimSpace(string(body))))
+	}
+
+	if s.URL != "" {
+		return s.URL + "/" + escapeKey(key), nil
+	}
+	return objectURL, nil
+}
+
+const amzDateLayout = "20060102T150405Z"
+
+// signV4 adds the AWS Signature Version 4 of the request, signing the host and every header already set.
+// The X-Amz-Date header must be set, the payload hash is the hex SHA-256 of the body.
+func signV4(req *http.Request, payloadHash string, accessKey string, secretKey string, region string) {
+	amzDate := req.Header.Get("X-Amz-Date")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", amzDate[:8], region)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{amzDate[:8], region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
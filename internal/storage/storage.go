@@ -0,0 +1,121 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/infograb-public/j2lab/internal/config"
+)
+
+// Storage keeps the attachments which are not uploaded to GitLab, the issues link to them.
+type Storage interface {
+	// Put stores the file under the key and returns the URL to link.
+	Put(key string, path string, sum string, contentType string) (string, error)
+}
+
+// New returns the S3 storage if a bucket is configured, else the local directory.
+func New(cfg *config.AttachmentStore) (Storage, error) {
+	if cfg.S3.Bucket != "" {
+		region := cfg.S3.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &S3{
+			Endpoint:  strings.TrimSuffix(cfg.S3.Endpoint, "/"),
+			Region:    region,
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    strings.Trim(cfg.S3.Prefix, "/"),
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			URL:       strings.TrimSuffix(cfg.URL, "/"),
+		}, nil
+	}
+
+	if cfg.Dir == "" {
+		return nil, errors.New("No attachment storage configured")
+	}
+
+	dir, err := filepath.Abs(cfg.Dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error getting absolute path")
+	}
+	return &Local{Dir: dir, URL: strings.TrimSuffix(cfg.URL, "/")}, nil
+}
+
+// Local copies the files into a directory, served from URL or linked by their file path.
+type Local struct {
+	Dir string
+	URL string
+}
+
+func (l *Local) Put(key string, path string, sum string, contentType string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(l.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", errors.Wrap(err, "Error creating directory")
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "Error opening file")
+	}
+	defer src.Close()
+
+	file, err := os.Create(dest)
+	if err != nil {
+		return "", errors.Wrap(err, "Error creating file")
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, src); err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Error copying file to %s", dest))
+	}
+
+	if l.URL != "" {
+		return l.URL + "/" + escapeKey(key), nil
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(dest)}).String(), nil
+}
+
+// validateKey rejects the empty, . and .. segments, the paths and URLs would clean them away from the key.
+func validateKey(key string) error {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return errors.Errorf("Invalid storage key: %s", key)
+		}
+	}
+	return nil
+}
+
+// escapeKey escapes each segment of the key for a URL path.
+// Only the unreserved characters are kept, as the S3 signature expects.
+func escapeKey(key string) string {
+	var b strings.Builder
+	for _, c := range []byte(key) {
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' || ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+/*
+ * This file is part of the InfoGrab project.
+ *
+ * Copyright (C) 2023 InfoGrab
+ *
+ * This program is free software: you can redistribute it and/or modify it
+ * it is available under the terms of the GNU Lesser General Public License
+ * by the Free Software Foundation, either version 3 of the License or by the Free Software Foundation
+ * (at your option) any later version.
+ */
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPut(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(src, []byte("video"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	local := &Local{Dir: t.TempDir(), URL: "https://files.infograb.net/jira"}
+
+	//* The keys never leave the directory
+	for _, key := range []string{"SSP/10000/..", "SSP/10000/.", "SSP/../..", "../video.mp4", "/video.mp4"} {
+		if _, err := local.Put(key, src, "", "video/mp4"); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+
+	url, err := local.Put("SSP/10000/video.mp4", src, "", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://files.infograb.net/jira/SSP/10000/video.mp4"; url != want {
+		t.Errorf("Put() = %s, want %s", url, want)
+	}
+}
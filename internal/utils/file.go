@@ -12,10 +12,14 @@
 package utils
 
 import (
+	"archive/tar"
 	"bufio"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -60,3 +64,108 @@ func CopyFile(w io.Writer, srcPath, destPath string) error {
 
 	return nil
 }
+
+// TarGzDirectory writes the files of the directory into a gzipped tarball, with paths relative to the directory
+func TarGzDirectory(dir, destPath string) error {
+	destFile, err := os.Create(destPath)
+	if err != nil {
+		return errors.Wrap(err, "error creating tarball")
+	}
+	defer destFile.Close()
+
+	gz := gzip.NewWriter(destFile)
+	tw := tar.NewWriter(gz)
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil || name == "." {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return errors.Wrap(err, "error writing tarball")
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "error writing tarball")
+	}
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(err, "error writing tarball")
+	}
+	return nil
+}
+
+// ExtractTarGz extracts a gzipped tarball into the directory, the paths outside the directory are refused
+func ExtractTarGz(srcPath, dir string) error {
+	srcFile, err := os.Open(srcPath)
+	if err != nil {
+		return errors.Wrap(err, "error opening tarball")
+	}
+	defer srcFile.Close()
+
+	gz, err := gzip.NewReader(srcFile)
+	if err != nil {
+		return errors.Wrap(err, "error reading tarball")
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "error reading tarball")
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return errors.Errorf("invalid path in tarball: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return errors.Wrap(err, "error creating directory")
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return errors.Wrap(err, "error creating directory")
+			}
+			file, err := os.Create(path)
+			if err != nil {
+				return errors.Wrap(err, "error creating file")
+			}
+			_, err = io.Copy(file, tr)
+			file.Close()
+			if err != nil {
+				return errors.Wrap(err, "error extracting file")
+			}
+		}
+	}
+}